@@ -0,0 +1,71 @@
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// An access that was granted by overriding the normal authorization rules (break-the-glass).
+// Every emergency access must be reviewed afterwards.
+type EmergencyAccessEvent struct {
+	Time           time.Time `json:"time"`
+	ClientId       string    `json:"clientId"`
+	Subject        string    `json:"subject"`
+	Pid            string    `json:"pid"`
+	TenantId       string    `json:"tenantId"`
+	SecurityLevel  string    `json:"securityLevel"`
+	Method         string    `json:"method"`
+	Path           string    `json:"path"`
+	RequiredScope  string    `json:"requiredScope"`
+	Reason         string    `json:"reason"`
+	ReviewRequired bool      `json:"reviewRequired"`
+}
+
+// Records emergency accesses to a dedicated audit stream, separate from the normal log,
+// and keeps them in memory so they can be exported as a report.
+type EmergencyAccessLog struct {
+	mutex  sync.Mutex
+	logger *log.Logger
+	events []EmergencyAccessEvent
+}
+
+func NewEmergencyAccessLog(stream io.Writer) *EmergencyAccessLog {
+	return &EmergencyAccessLog{
+		logger: log.New(stream, "EMERGENCY ACCESS ", log.LstdFlags|log.LUTC),
+	}
+}
+
+// The audit stream of the API. In production this should be written to
+// a tamper-evident store that is monitored, not to stderr.
+var EmergencyAccess = NewEmergencyAccessLog(os.Stderr)
+
+// Records the event and flags it for review.
+func (l *EmergencyAccessLog) Record(event EmergencyAccessEvent) {
+	event.ReviewRequired = true
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.events = append(l.events, event)
+
+	eventJson, err := json.Marshal(event)
+	if err != nil {
+		l.logger.Printf("failed to serialize event: %v", err)
+		return
+	}
+	l.logger.Println(string(eventJson))
+}
+
+// Returns all recorded events, oldest first.
+func (l *EmergencyAccessLog) Report() []EmergencyAccessEvent {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	report := make([]EmergencyAccessEvent, len(l.events))
+	copy(report, l.events)
+	return report
+}
@@ -17,20 +17,28 @@ const authorizationServerMetadataUrl = "https://helseid-sts.utvikling.nhn.no/.we
 
 // Middleware that will only redirect to next if the token in the request is valid.
 // If the token is not found or is not valid it will respond with http error 401 unauthorized.
+// The principal of the token is added to the request, see PrincipalFromRequest.
 func IsAuthenticatedMiddleware(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
-	_, err := getTokenFromAuthHeaderAndValidate(r)
+	token, err := getTokenFromAuthHeaderAndValidate(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
 
-	next(w, r)
+	principal, err := newPrincipal(token)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	next(w, withPrincipal(r, principal))
 }
 
 // Middleware that will only redirect to next if the token in the request
 // is valid and the required scope is in the scopes in token.
 // If the token is not found, is not valid, or the token did not have
 // the required scope it will respond with http error 401 unauthorized.
+// The principal of the token is added to the request, see PrincipalFromRequest.
 func IsAuthenticatedAndAuthorizedMiddleware(requiredScope string) func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
 	return func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
 		token, err := getTokenFromAuthHeaderAndValidate(r)
@@ -39,34 +47,65 @@ func IsAuthenticatedAndAuthorizedMiddleware(requiredScope string) func(w http.Re
 			return
 		}
 
-		var claims struct {
-			Scopes []string `json:"scope"`
+		principal, err := newPrincipal(token)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
 		}
-		// signature already verified in getTokenFromAuthHeaderAndValidate
-		token.UnsafeClaimsWithoutVerification(&claims)
-
-		for _, scope := range claims.Scopes {
-			if scope == requiredScope {
-				next(w, r)
-				return
-			}
+
+		if principal.HasScope(requiredScope) {
+			next(w, withPrincipal(r, principal))
+			return
 		}
 
 		http.Error(w, "access token did not contain the required scope", http.StatusUnauthorized)
 	}
 }
 
+// Middleware that will only redirect to next if the request was made with a user token,
+// a token issued to a client on behalf of an end-user.
+// Must be used after IsAuthenticatedMiddleware or IsAuthenticatedAndAuthorizedMiddleware.
+// If the token is a client token it will respond with http error 403 forbidden.
+func RequireUserTokenMiddleware(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	requireTokenType(TokenTypeUser, w, r, next)
+}
+
+// Middleware that will only redirect to next if the request was made with a client token,
+// a token issued to a client acting on its own behalf with the client credentials grant.
+// Must be used after IsAuthenticatedMiddleware or IsAuthenticatedAndAuthorizedMiddleware.
+// If the token is a user token it will respond with http error 403 forbidden.
+func RequireClientTokenMiddleware(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	requireTokenType(TokenTypeClient, w, r, next)
+}
+
+func requireTokenType(tokenType TokenType, w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	principal, ok := PrincipalFromRequest(r)
+	if !ok {
+		http.Error(w, "request is not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	if principal.TokenType != tokenType {
+		http.Error(w, "endpoint requires a "+string(tokenType)+" token, got a "+string(principal.TokenType)+" token", http.StatusForbidden)
+		return
+	}
+
+	next(w, r)
+}
+
 func getTokenFromAuthHeaderAndValidate(r *http.Request) (*jwt.JSONWebToken, error) {
 	authHeader := r.Header.Get("Authorization")
 
 	authHeaderParts := strings.Fields(authHeader)
-	if len(authHeaderParts) != 2 || strings.ToLower(authHeaderParts[0]) != "bearer" {
-		return nil, errors.New("authorization header format must be: Bearer {the base64 url encoded access token without curly braces}")
+	if len(authHeaderParts) != 2 || (strings.ToLower(authHeaderParts[0]) != "bearer" && strings.ToLower(authHeaderParts[0]) != "dpop") {
+		return nil, errors.New("authorization header format must be: Bearer {the base64 url encoded access token without curly braces}, or DPoP {...} for DPoP bound tokens")
 	}
 
+	scheme := strings.ToLower(authHeaderParts[0])
 	tokenString := authHeaderParts[1]
 
-	token, err := jwt.ParseSigned(tokenString)
+	// encrypted access tokens are decrypted here, before the signature is verified below
+	token, err := parseToken(tokenString)
 	if err != nil {
 		return nil, err
 	}
@@ -93,6 +132,12 @@ func getTokenFromAuthHeaderAndValidate(r *http.Request) (*jwt.JSONWebToken, erro
 		return nil, errors.New("access token contained multiple audiences")
 	}
 
+	// check that a DPoP bound token is sent with a valid DPoP proof
+	err = verifyTokenBinding(r, scheme, tokenString, token)
+	if err != nil {
+		return nil, err
+	}
+
 	/*
 		// here you can extract any claims from the access token
 		extraClaims := struct {
@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// how old a DPoP proof can be, and how far in the future it can be created, before it is rejected
+const maxDPoPProofAge = 5 * time.Minute
+
+// the signature algorithms accepted for DPoP proofs
+var allowedDPoPAlgorithms = []string{"ES256", "ES384", "PS256", "RS256"}
+
+// The ids (jti) of the DPoP proofs used within maxDPoPProofAge, to prevent replay of proofs.
+var usedDPoPProofs = map[string]time.Time{}
+var usedDPoPProofsMutex sync.Mutex
+
+// Checks that the token is sent with the scheme matching how it is bound.
+// A token bound to a DPoP key (cnf.jkt) must be sent with the DPoP scheme and a valid DPoP proof
+// created with that key (RFC 9449), and a bearer token must be sent with the Bearer scheme.
+func verifyTokenBinding(r *http.Request, scheme, tokenString string, token *jwt.JSONWebToken) error {
+	var claims struct {
+		Confirmation struct {
+			JwkThumbprint string `json:"jkt"`
+		} `json:"cnf"`
+	}
+	// signature already verified in getTokenFromAuthHeaderAndValidate
+	err := token.UnsafeClaimsWithoutVerification(&claims)
+	if err != nil {
+		return err
+	}
+	jkt := claims.Confirmation.JwkThumbprint
+
+	if scheme == "bearer" {
+		if jkt != "" {
+			return errors.New("DPoP bound access token must be sent with the DPoP authorization scheme")
+		}
+		return nil
+	}
+
+	if jkt == "" {
+		return errors.New("access token sent with the DPoP authorization scheme is not DPoP bound")
+	}
+
+	return verifyDPoPProof(r, tokenString, jkt)
+}
+
+func verifyDPoPProof(r *http.Request, accessToken, jkt string) error {
+	proofs := r.Header.Values("DPoP")
+	if len(proofs) != 1 {
+		return errors.New("request must contain exactly one DPoP proof")
+	}
+
+	proof, err := jose.ParseSigned(proofs[0])
+	if err != nil {
+		return err
+	}
+	if len(proof.Signatures) != 1 {
+		return errors.New("DPoP proof must have exactly one signature")
+	}
+
+	header := proof.Signatures[0].Protected
+	if typ, _ := header.ExtraHeaders[jose.HeaderType].(string); typ != "dpop+jwt" {
+		return errors.New("DPoP proof must have the type dpop+jwt")
+	}
+	if !containsString(allowedDPoPAlgorithms, header.Algorithm) {
+		return errors.New("DPoP proof is signed with an unsupported algorithm: " + header.Algorithm)
+	}
+	if header.JSONWebKey == nil || !header.JSONWebKey.IsPublic() {
+		return errors.New("DPoP proof must contain the public key it is signed with")
+	}
+
+	payload, err := proof.Verify(header.JSONWebKey)
+	if err != nil {
+		return err
+	}
+
+	var claims struct {
+		Id       string `json:"jti"`
+		Method   string `json:"htm"`
+		Url      string `json:"htu"`
+		IssuedAt int64  `json:"iat"`
+		Ath      string `json:"ath"`
+	}
+	err = json.Unmarshal(payload, &claims)
+	if err != nil {
+		return err
+	}
+
+	if claims.Method != r.Method {
+		return errors.New("DPoP proof was created for another http method")
+	}
+
+	// the htu claim is compared without query and fragment
+	if strings.SplitN(claims.Url, "?", 2)[0] != getRequestUrl(r) {
+		return errors.New("DPoP proof was created for another url")
+	}
+
+	issuedAt := time.Unix(claims.IssuedAt, 0)
+	if time.Since(issuedAt) > maxDPoPProofAge || time.Until(issuedAt) > maxDPoPProofAge {
+		return errors.New("DPoP proof is expired or created in the future")
+	}
+
+	hash := sha256.Sum256([]byte(accessToken))
+	if subtle.ConstantTimeCompare([]byte(claims.Ath), []byte(base64.RawURLEncoding.EncodeToString(hash[:]))) != 1 {
+		return errors.New("DPoP proof was created for another access token")
+	}
+
+	thumbprint, err := header.JSONWebKey.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return err
+	}
+	if base64.RawURLEncoding.EncodeToString(thumbprint) != jkt {
+		return errors.New("DPoP proof is not signed with the key the access token is bound to")
+	}
+
+	if claims.Id == "" || !markDPoPProofAsUsed(claims.Id) {
+		return errors.New("DPoP proof has already been used")
+	}
+
+	return nil
+}
+
+// The url of the request without query, as the client sees it.
+func getRequestUrl(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + r.URL.EscapedPath()
+}
+
+// Returns false if the proof id has been used before.
+func markDPoPProofAsUsed(id string) bool {
+	usedDPoPProofsMutex.Lock()
+	defer usedDPoPProofsMutex.Unlock()
+
+	for usedId, usedAt := range usedDPoPProofs {
+		if time.Since(usedAt) > 2*maxDPoPProofAge {
+			delete(usedDPoPProofs, usedId)
+		}
+	}
+
+	if _, ok := usedDPoPProofs[id]; ok {
+		return false
+	}
+	usedDPoPProofs[id] = time.Now()
+	return true
+}
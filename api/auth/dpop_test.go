@@ -0,0 +1,284 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+type dpopProofClaims struct {
+	Id       string `json:"jti"`
+	Method   string `json:"htm"`
+	Url      string `json:"htu"`
+	IssuedAt int64  `json:"iat"`
+	Ath      string `json:"ath"`
+}
+
+func createDPoPProof(t *testing.T, key interface{}, alg jose.SignatureAlgorithm, typ string, claims dpopProofClaims) string {
+	options := (&jose.SignerOptions{EmbedJWK: true}).WithType(jose.ContentType(typ))
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: alg, Key: key}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proof, err := jwt.Signed(signer).Claims(claims).CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proof
+}
+
+func jwkThumbprint(t *testing.T, key crypto.PublicKey) string {
+	thumbprint, err := (&jose.JSONWebKey{Key: key}).Thumbprint(crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(thumbprint)
+}
+
+func TestVerifyDPoPProof(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anotherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const accessToken = "access-token"
+	const requestUrl = "https://localhost:5001/api/notes"
+	hash := sha256.Sum256([]byte(accessToken))
+	ath := base64.RawURLEncoding.EncodeToString(hash[:])
+	jkt := jwkThumbprint(t, key.Public())
+
+	// the proof ids are remembered by markDPoPProofAsUsed, so they must be unique for each run of the test
+	run := strconv.FormatInt(time.Now().UnixNano(), 36)
+	validClaims := func(id string) dpopProofClaims {
+		if id != "" {
+			id += "-" + run
+		}
+		return dpopProofClaims{Id: id, Method: "GET", Url: requestUrl, IssuedAt: time.Now().Unix(), Ath: ath}
+	}
+	replayed := createDPoPProof(t, key, jose.ES256, "dpop+jwt", validClaims("replayed"))
+
+	tests := []struct {
+		name    string
+		proofs  []string
+		method  string
+		url     string
+		jkt     string
+		wantErr bool
+	}{
+		{
+			name:   "valid",
+			proofs: []string{createDPoPProof(t, key, jose.ES256, "dpop+jwt", validClaims("valid"))},
+		},
+		{
+			name:   "query is ignored",
+			proofs: []string{createDPoPProof(t, key, jose.ES256, "dpop+jwt", validClaims("query"))},
+			url:    requestUrl + "?page=2",
+		},
+		{
+			name:   "rsa key",
+			proofs: []string{createDPoPProof(t, rsaKey, jose.PS256, "dpop+jwt", validClaims("rsa"))},
+			jkt:    jwkThumbprint(t, rsaKey.Public()),
+		},
+		{
+			name:    "missing proof",
+			proofs:  nil,
+			wantErr: true,
+		},
+		{
+			name: "two proofs",
+			proofs: []string{
+				createDPoPProof(t, key, jose.ES256, "dpop+jwt", validClaims("first")),
+				createDPoPProof(t, key, jose.ES256, "dpop+jwt", validClaims("second")),
+			},
+			wantErr: true,
+		},
+		{
+			name:    "wrong type",
+			proofs:  []string{createDPoPProof(t, key, jose.ES256, "JWT", validClaims("type"))},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported algorithm",
+			proofs:  []string{createDPoPProof(t, rsaKey, jose.RS512, "dpop+jwt", validClaims("algorithm"))},
+			jkt:     jwkThumbprint(t, rsaKey.Public()),
+			wantErr: true,
+		},
+		{
+			name:    "wrong method",
+			proofs:  []string{createDPoPProof(t, key, jose.ES256, "dpop+jwt", validClaims("method"))},
+			method:  "POST",
+			wantErr: true,
+		},
+		{
+			name:    "wrong url",
+			proofs:  []string{createDPoPProof(t, key, jose.ES256, "dpop+jwt", validClaims("url"))},
+			url:     "https://localhost:5001/api/notes/1",
+			wantErr: true,
+		},
+		{
+			name: "expired",
+			proofs: []string{createDPoPProof(t, key, jose.ES256, "dpop+jwt", func() dpopProofClaims {
+				claims := validClaims("expired")
+				claims.IssuedAt = time.Now().Add(-maxDPoPProofAge - time.Minute).Unix()
+				return claims
+			}())},
+			wantErr: true,
+		},
+		{
+			name: "created in the future",
+			proofs: []string{createDPoPProof(t, key, jose.ES256, "dpop+jwt", func() dpopProofClaims {
+				claims := validClaims("future")
+				claims.IssuedAt = time.Now().Add(maxDPoPProofAge + time.Minute).Unix()
+				return claims
+			}())},
+			wantErr: true,
+		},
+		{
+			name: "wrong access token hash",
+			proofs: []string{createDPoPProof(t, key, jose.ES256, "dpop+jwt", func() dpopProofClaims {
+				claims := validClaims("ath")
+				another := sha256.Sum256([]byte("another-access-token"))
+				claims.Ath = base64.RawURLEncoding.EncodeToString(another[:])
+				return claims
+			}())},
+			wantErr: true,
+		},
+		{
+			name:    "signed with another key than the token is bound to",
+			proofs:  []string{createDPoPProof(t, anotherKey, jose.ES256, "dpop+jwt", validClaims("another key"))},
+			wantErr: true,
+		},
+		{
+			name:    "missing jti",
+			proofs:  []string{createDPoPProof(t, key, jose.ES256, "dpop+jwt", validClaims(""))},
+			wantErr: true,
+		},
+		{
+			name:   "first use of proof",
+			proofs: []string{replayed},
+		},
+		{
+			name:    "replayed proof",
+			proofs:  []string{replayed},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			method := test.method
+			if method == "" {
+				method = "GET"
+			}
+			url := test.url
+			if url == "" {
+				url = requestUrl
+			}
+			boundTo := test.jkt
+			if boundTo == "" {
+				boundTo = jkt
+			}
+
+			r := httptest.NewRequest(method, url, nil)
+			for _, proof := range test.proofs {
+				r.Header.Add("DPoP", proof)
+			}
+
+			err := verifyDPoPProof(r, accessToken, boundTo)
+			if test.wantErr && err == nil {
+				t.Error("got no error, want an error")
+			}
+			if !test.wantErr && err != nil {
+				t.Errorf("got error %v, want no error", err)
+			}
+		})
+	}
+}
+
+func TestVerifyTokenBinding(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jkt := jwkThumbprint(t, key.Public())
+
+	createToken := func(jkt string) string {
+		claims := map[string]interface{}{"sub": "user"}
+		if jkt != "" {
+			claims["cnf"] = map[string]string{"jkt": jkt}
+		}
+		token, err := jwt.Signed(signer).Claims(claims).CompactSerialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name      string
+		scheme    string
+		boundTo   string
+		withProof bool
+		wantErr   bool
+	}{
+		{name: "bearer token with bearer scheme", scheme: "bearer"},
+		{name: "bound token with dpop scheme and proof", scheme: "dpop", boundTo: jkt, withProof: true},
+		{name: "bound token with bearer scheme", scheme: "bearer", boundTo: jkt, wantErr: true},
+		{name: "bearer token with dpop scheme", scheme: "dpop", withProof: true, wantErr: true},
+		{name: "bound token with dpop scheme without proof", scheme: "dpop", boundTo: jkt, wantErr: true},
+	}
+
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tokenString := createToken(test.boundTo)
+			token, err := jwt.ParseSigned(tokenString)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest("GET", "https://localhost:5001/api/notes", nil)
+			if test.withProof {
+				hash := sha256.Sum256([]byte(tokenString))
+				r.Header.Set("DPoP", createDPoPProof(t, key, jose.ES256, "dpop+jwt", dpopProofClaims{
+					Id:       "binding-" + strconv.Itoa(i) + "-" + strconv.FormatInt(time.Now().UnixNano(), 36),
+					Method:   "GET",
+					Url:      "https://localhost:5001/api/notes",
+					IssuedAt: time.Now().Unix(),
+					Ath:      base64.RawURLEncoding.EncodeToString(hash[:]),
+				}))
+			}
+
+			err = verifyTokenBinding(r, test.scheme, tokenString, token)
+			if test.wantErr && err == nil {
+				t.Error("got no error, want an error")
+			}
+			if !test.wantErr && err != nil {
+				t.Errorf("got error %v, want no error", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"hello-go-rest-api/audit"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The header the caller must use to justify emergency access.
+const EmergencyAccessReasonHeader = "X-Emergency-Access-Reason"
+
+const maxEmergencyAccessReasonLength = 500
+
+// Middleware that works like IsAuthenticatedAndAuthorizedMiddleware, except that a user
+// without the required scope is still let through in an emergency (break-the-glass).
+// To use emergency access the caller must supply a justification in the X-Emergency-Access-Reason
+// header and be authenticated with at least the given security level.
+// Every emergency access is recorded in the audit.EmergencyAccess stream and flagged for review.
+func IsAuthenticatedAndAuthorizedOrEmergencyAccessMiddleware(requiredScope string, minimumSecurityLevel int) func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	return func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		token, err := getTokenFromAuthHeaderAndValidate(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		principal, err := newPrincipal(token)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		if principal.HasScope(requiredScope) {
+			next(w, withPrincipal(r, principal))
+			return
+		}
+
+		reason := strings.TrimSpace(r.Header.Get(EmergencyAccessReasonHeader))
+		if reason == "" {
+			http.Error(w, "access token did not contain the required scope", http.StatusUnauthorized)
+			return
+		}
+		if len(reason) > maxEmergencyAccessReasonLength {
+			http.Error(w, "emergency access reason is too long", http.StatusBadRequest)
+			return
+		}
+
+		// only health personnel can break the glass, not systems
+		if !principal.IsUser() {
+			http.Error(w, "emergency access requires a user token", http.StatusForbidden)
+			return
+		}
+
+		if securityLevel, _ := strconv.Atoi(principal.SecurityLevel); securityLevel < minimumSecurityLevel {
+			http.Error(w, "emergency access requires security level "+strconv.Itoa(minimumSecurityLevel), http.StatusForbidden)
+			return
+		}
+
+		audit.EmergencyAccess.Record(audit.EmergencyAccessEvent{
+			Time:          time.Now().UTC(),
+			ClientId:      principal.ClientId,
+			Subject:       principal.Subject,
+			Pid:           principal.Pid,
+			TenantId:      principal.TenantId(),
+			SecurityLevel: principal.SecurityLevel,
+			Method:        r.Method,
+			Path:          r.URL.Path,
+			RequiredScope: requiredScope,
+			Reason:        reason,
+		})
+
+		principal.EmergencyAccessReason = reason
+		next(w, withPrincipal(r, principal))
+	}
+}
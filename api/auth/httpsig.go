@@ -0,0 +1,382 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/square/go-jose.v2"
+)
+
+// the components that must be covered by the HTTP Message Signature (RFC 9421)
+var requiredSignatureComponents = []string{"@method", "@path", "content-digest", "authorization"}
+
+// how old a signature can be, and how far in the future it can be created, before it is rejected
+const maxSignatureAge = 5 * time.Minute
+const maxSignatureClockSkew = time.Minute
+
+// the current time when checking the created parameter, replaced in tests
+var timeNow = time.Now
+
+// the largest body of a signed request, the body is read into memory to check the Content-Digest
+const maxSignedBodySize = 1 << 20
+
+var errBodyTooLarge = errors.New("request body is too large")
+
+// Public keys of the clients that are allowed to sign requests, keyed by client id.
+// The m2m app signs its requests with the same key it uses for client assertions.
+var clientPublicKeys = map[string]string{
+	"golang-m2m-app": `{
+		"kty": "RSA",
+		"e": "AQAB",
+		"use": "sig",
+		"kid": "XjDfM0IZgCCGtpAmKfNmyVQskjg=",
+		"alg": "PS256",
+		"n": "iw4rZkmU6oTNnf-4ecCA4Bx_zgbLbaqOHypA-YZ0y0isIV-1FDOqDk5pTLl1gVaigmQ2za6cOXyCXSZD5A5fazdvW14Cx1MiMEqqSYir8IdgGrUaZ6Zro2Tt4mNdjZm-HkHtJjFlVcYkl1xslzkB71OFMswCp7Vel8GsWqLbB157BxpjhT8bkhs9YPod8Pr2AacbCIaGdEGQyXEAlQwApSv1nnDn-qXoFJk0TK5aAZOgQKvgEZdUGawCq5TTGycqNh6N6I_9WND2WgXUh_eX7UQPTT6bj-F51TczfJlsDcKbGFeFT_UR592uF2zsxRunArvuXvi8zi57owH6p4FEv_FvJB8dUY23Q1ZI2PqmFRqn2K2KHdMrhN5RHGuL2JzdY23Yy739PAZ7MGkhdPK4G8RGNaYJD6t0tt-z_A0fSZSEqpTfE2-rPgII0zlGfQ0oDWCaGEfNk4lGCZBifEq-G7U4sPSsAQHpJWS9GBoyucNQ-j8ZnQcaNa3hQXWKLIZaE1adSLgWPWp40SS6_yWztQLgRdVm9UirE0eOSze54p98IVPpMoSLxdylXa8YNTE3z58EnfnrbzPobeSZ5olZcSZc_cAsscvyFktetRWgHFcpGRQfKcSM-e-vNnJWmLYFRwzOIm9oo_xBfet5n_05cR0bYzQht2mGCoI-9M71l_0"
+	}`,
+}
+
+// Resolves the public key used to verify the HTTP Message Signature of a request.
+// clientId is the client_id claim of the access token and keyId is the keyid parameter of the signature.
+// Replace this to look up keys somewhere else than in clientPublicKeys, e.g. in a database.
+var ClientPublicKeyResolver = func(clientId, keyId string) (*jose.JSONWebKey, error) {
+	keyJson, ok := clientPublicKeys[clientId]
+	if !ok {
+		return nil, fmt.Errorf("no public key registered for client %v", clientId)
+	}
+
+	key := jose.JSONWebKey{}
+	err := key.UnmarshalJSON([]byte(keyJson))
+	if err != nil {
+		return nil, err
+	}
+
+	if keyId != "" && key.KeyID != "" && keyId != key.KeyID {
+		return nil, fmt.Errorf("signature key id %v is not registered for client %v", keyId, clientId)
+	}
+
+	return &key, nil
+}
+
+// Middleware that will only redirect to next if the request has a valid HTTP Message Signature (RFC 9421)
+// covering the method, path, content-digest and authorization of the request.
+// The signature is verified with the public key of the client the access token was issued to.
+// If the signature is missing or not valid it will respond with http error 401 unauthorized.
+// The token is only validated if no earlier middleware has added the principal to the request.
+func HttpMessageSignatureMiddleware(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	principal, ok := PrincipalFromRequest(r)
+	if !ok {
+		token, err := getTokenFromAuthHeaderAndValidate(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		principal, err = newPrincipal(token)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		r = withPrincipal(r, principal)
+	}
+
+	err := verifyHttpMessageSignature(w, r, principal.ClientId)
+	if err == errBodyTooLarge {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, "invalid http message signature: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	next(w, r)
+}
+
+func verifyHttpMessageSignature(w http.ResponseWriter, r *http.Request, clientId string) error {
+	label, signatureParams, err := parseSignatureInput(strings.Join(r.Header.Values("Signature-Input"), ", "))
+	if err != nil {
+		return err
+	}
+
+	signature, err := parseSignature(strings.Join(r.Header.Values("Signature"), ", "), label)
+	if err != nil {
+		return err
+	}
+
+	components, params, err := parseSignatureParams(signatureParams)
+	if err != nil {
+		return err
+	}
+
+	for _, required := range requiredSignatureComponents {
+		if !containsString(components, required) {
+			return fmt.Errorf("signature does not cover %v", required)
+		}
+	}
+
+	created, err := strconv.ParseInt(params["created"], 10, 64)
+	if err != nil {
+		return errors.New("signature is missing the created parameter")
+	}
+	createdAt := time.Unix(created, 0)
+	if timeNow().Sub(createdAt) > maxSignatureAge || createdAt.Sub(timeNow()) > maxSignatureClockSkew {
+		return errors.New("signature is expired or created in the future")
+	}
+
+	err = verifyContentDigest(w, r)
+	if err != nil {
+		return err
+	}
+
+	key, err := ClientPublicKeyResolver(clientId, params["keyid"])
+	if err != nil {
+		return err
+	}
+
+	signatureBase, err := createSignatureBase(r, components, signatureParams)
+	if err != nil {
+		return err
+	}
+
+	return verifySignature(key, params["alg"], []byte(signatureBase), signature)
+}
+
+// Parses the first signature in the Signature-Input header,
+// e.g. sig1=("@method" "@path");created=1618884473;keyid="key"
+// Returns the label of the signature and the serialized signature parameters.
+func parseSignatureInput(header string) (string, string, error) {
+	if header == "" {
+		return "", "", errors.New("missing Signature-Input header")
+	}
+
+	members, err := parseDictionary(header)
+	if err != nil {
+		return "", "", fmt.Errorf("malformed Signature-Input header: %v", err)
+	}
+
+	// only the first signature is used if the client sent several
+	if _, ok := members[0].Value.([]sfItem); !ok {
+		return "", "", errors.New("malformed Signature-Input header")
+	}
+	return members[0].Name, members[0].Raw, nil
+}
+
+// Finds the signature with the given label in the Signature header, e.g. sig1=:base64 encoded signature:
+func parseSignature(header, label string) ([]byte, error) {
+	if header == "" {
+		return nil, errors.New("missing Signature header")
+	}
+
+	members, err := parseDictionary(header)
+	if err != nil {
+		return nil, fmt.Errorf("malformed Signature header: %v", err)
+	}
+
+	for _, member := range members {
+		if member.Name != label {
+			continue
+		}
+		signature, ok := member.Value.([]byte)
+		if !ok {
+			return nil, errors.New("malformed Signature header")
+		}
+		return signature, nil
+	}
+
+	return nil, fmt.Errorf("no signature with label %v in Signature header", label)
+}
+
+// Parses serialized signature parameters, e.g. ("@method" "@path");created=1618884473;keyid="key"
+// into the list of covered components and the parameters.
+// Components with parameters, e.g. "content-digest";sf, are not supported and are rejected.
+func parseSignatureParams(signatureParams string) ([]string, map[string]string, error) {
+	items, sfParams, err := parseInnerList(signatureParams)
+	if err != nil {
+		return nil, nil, fmt.Errorf("malformed signature parameters: %v", err)
+	}
+
+	components := []string{}
+	for _, item := range items {
+		component, ok := item.Value.(string)
+		if !ok || len(item.Params) > 0 {
+			return nil, nil, fmt.Errorf("unsupported covered component %v, component parameters are not supported", item.Value)
+		}
+		components = append(components, component)
+	}
+
+	// created and expires are integers, the other parameters (keyid, alg, nonce and tag) are strings
+	params := map[string]string{}
+	for _, param := range sfParams {
+		switch value := param.Value.(type) {
+		case int64:
+			if param.Name != "created" && param.Name != "expires" {
+				return nil, nil, fmt.Errorf("signature parameter %v must be a string", param.Name)
+			}
+			params[param.Name] = strconv.FormatInt(value, 10)
+		case string:
+			if param.Name == "created" || param.Name == "expires" {
+				return nil, nil, fmt.Errorf("signature parameter %v must be an integer", param.Name)
+			}
+			params[param.Name] = value
+		default:
+			return nil, nil, fmt.Errorf("unsupported value of signature parameter %v", param.Name)
+		}
+	}
+
+	return components, params, nil
+}
+
+// Creates the signature base as defined in RFC 9421 section 2.5.
+func createSignatureBase(r *http.Request, components []string, signatureParams string) (string, error) {
+	var base strings.Builder
+	for _, component := range components {
+		var value string
+		switch component {
+		case "@method":
+			value = strings.ToUpper(r.Method)
+		case "@path":
+			value = r.URL.EscapedPath()
+		default:
+			if strings.HasPrefix(component, "@") {
+				return "", fmt.Errorf("unsupported derived component %v", component)
+			}
+			values := r.Header.Values(component)
+			if len(values) == 0 {
+				return "", fmt.Errorf("signed header %v is missing from the request", component)
+			}
+			trimmed := make([]string, len(values))
+			for i, v := range values {
+				trimmed[i] = strings.TrimSpace(v)
+			}
+			value = strings.Join(trimmed, ", ")
+		}
+		fmt.Fprintf(&base, "\"%v\": %v\n", component, value)
+	}
+	fmt.Fprintf(&base, "\"@signature-params\": %v", signatureParams)
+
+	return base.String(), nil
+}
+
+// Checks that the Content-Digest header (RFC 9530) matches the body of the request.
+// The header may contain digests with several algorithms, e.g. sha-256=:...:, sha-512=:...:
+// every sha-256 and sha-512 digest must match, digests with other algorithms are ignored,
+// and the request is rejected if there is no sha-256 or sha-512 digest.
+func verifyContentDigest(w http.ResponseWriter, r *http.Request) error {
+	digests, err := parseContentDigest(strings.Join(r.Header.Values("Content-Digest"), ", "))
+	if err != nil {
+		return err
+	}
+
+	body := []byte{}
+	if r.Body != nil {
+		body, err = ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxSignedBodySize))
+		r.Body.Close()
+		if err != nil {
+			if len(body) >= maxSignedBodySize {
+				return errBodyTooLarge
+			}
+			return err
+		}
+	}
+	// put the body back so the next handler can read it
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	verified := false
+	for algorithm, expected := range digests {
+		var actual []byte
+		switch algorithm {
+		case "sha-256":
+			sum := sha256.Sum256(body)
+			actual = sum[:]
+		case "sha-512":
+			sum := sha512.Sum512(body)
+			actual = sum[:]
+		default:
+			continue
+		}
+
+		if subtle.ConstantTimeCompare(expected, actual) != 1 {
+			return errors.New("Content-Digest does not match the body")
+		}
+		verified = true
+	}
+
+	if !verified {
+		return errors.New("Content-Digest has no sha-256 or sha-512 digest")
+	}
+	return nil
+}
+
+// Parses the dictionary in a Content-Digest header into the digests by algorithm.
+func parseContentDigest(header string) (map[string][]byte, error) {
+	if strings.TrimSpace(header) == "" {
+		return nil, errors.New("missing Content-Digest header")
+	}
+
+	members, err := parseDictionary(header)
+	if err != nil {
+		return nil, fmt.Errorf("malformed Content-Digest header: %v", err)
+	}
+
+	digests := map[string][]byte{}
+	for _, member := range members {
+		digest, ok := member.Value.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("malformed Content-Digest header: the %v digest is not a byte sequence", member.Name)
+		}
+		digests[member.Name] = digest
+	}
+
+	return digests, nil
+}
+
+func verifySignature(key *jose.JSONWebKey, alg string, signatureBase, signature []byte) error {
+	switch publicKey := key.Public().Key.(type) {
+	case *rsa.PublicKey:
+		switch alg {
+		case "", "rsa-pss-sha512":
+			hash := sha512.Sum512(signatureBase)
+			return rsa.VerifyPSS(publicKey, crypto.SHA512, hash[:], signature, &rsa.PSSOptions{SaltLength: 64})
+		case "rsa-v1_5-sha256":
+			hash := sha256.Sum256(signatureBase)
+			return rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hash[:], signature)
+		}
+	case *ecdsa.PublicKey:
+		if alg == "" || alg == "ecdsa-p256-sha256" {
+			if len(signature) != 64 {
+				return errors.New("invalid ecdsa signature length")
+			}
+			hash := sha256.Sum256(signatureBase)
+			r := new(big.Int).SetBytes(signature[:32])
+			s := new(big.Int).SetBytes(signature[32:])
+			if !ecdsa.Verify(publicKey, hash[:], r, s) {
+				return errors.New("signature verification failed")
+			}
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unsupported signature algorithm %v for key %v", alg, key.KeyID)
+}
+
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
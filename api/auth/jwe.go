@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// Name of the environment variable containing the private keys used to decrypt encrypted access tokens.
+// The value must be a JWK set, e.g. {"keys": [{"kty": "RSA", "kid": "...", ...}]}.
+// Add the new key to the set before the public key is registered at HelseID, and remove the old key
+// when no tokens encrypted with it can still be valid, to rotate keys without rejecting any tokens.
+// If the variable is not set the API only accepts signed (not encrypted) access tokens.
+const tokenDecryptionKeysEnv = "HELSEID_API_TOKEN_DECRYPTION_KEYS"
+
+// the key management algorithms accepted for encrypted access tokens
+var allowedKeyAlgorithms = []jose.KeyAlgorithm{
+	jose.RSA_OAEP,
+	jose.RSA_OAEP_256,
+	jose.ECDH_ES,
+	jose.ECDH_ES_A128KW,
+	jose.ECDH_ES_A192KW,
+	jose.ECDH_ES_A256KW,
+}
+
+var tokenDecryptionKeys []jose.JSONWebKey
+
+// Loads the private keys used to decrypt encrypted access tokens from the environment.
+func LoadTokenDecryptionKeys() {
+	keysJson := os.Getenv(tokenDecryptionKeysEnv)
+	if keysJson == "" {
+		return
+	}
+
+	keySet := jose.JSONWebKeySet{}
+	err := json.Unmarshal([]byte(keysJson), &keySet)
+	if err != nil {
+		log.Fatalf("Failed to parse the token decryption keys in %v\n    Error: %s\n", tokenDecryptionKeysEnv, err.Error())
+	}
+
+	for _, key := range keySet.Keys {
+		if key.IsPublic() {
+			log.Fatalf("The token decryption key %v in %v is not a private key\n", key.KeyID, tokenDecryptionKeysEnv)
+		}
+	}
+
+	tokenDecryptionKeys = keySet.Keys
+}
+
+// Parses an access token that is either a signed JWT (JWS),
+// or a signed JWT nested in an encrypted JWT (JWE). The signature is not verified.
+func parseToken(tokenString string) (*jwt.JSONWebToken, error) {
+	// a compact JWS has three parts and a compact JWE has five
+	if strings.Count(tokenString, ".") != 4 {
+		return jwt.ParseSigned(tokenString)
+	}
+
+	return decryptToken(tokenString)
+}
+
+func decryptToken(tokenString string) (*jwt.JSONWebToken, error) {
+	if len(tokenDecryptionKeys) == 0 {
+		return nil, errors.New("access token is encrypted, but no token decryption keys are configured")
+	}
+
+	nestedToken, err := jwt.ParseSignedAndEncrypted(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	header := nestedToken.Headers[0]
+	if !isAllowedKeyAlgorithm(header.Algorithm) {
+		return nil, fmt.Errorf("access token is encrypted with an unsupported algorithm: %v", header.Algorithm)
+	}
+
+	// try all keys with a matching key id, there may be several keys during rotation
+	for _, key := range tokenDecryptionKeys {
+		if header.KeyID != "" && key.KeyID != "" && header.KeyID != key.KeyID {
+			continue
+		}
+
+		token, err := nestedToken.Decrypt(key.Key)
+		if err == nil {
+			return token, nil
+		}
+	}
+
+	return nil, errors.New("failed to decrypt access token with the configured token decryption keys")
+}
+
+func isAllowedKeyAlgorithm(algorithm string) bool {
+	for _, allowed := range allowedKeyAlgorithms {
+		if string(allowed) == algorithm {
+			return true
+		}
+	}
+	return false
+}
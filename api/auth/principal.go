@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+type principalContextKey struct{}
+
+type TokenType string
+
+const (
+	// the token was issued to a client on behalf of an end-user, e.g. the web app
+	TokenTypeUser TokenType = "user"
+	// the token was issued to a client acting on its own behalf, e.g. the m2m app
+	TokenTypeClient TokenType = "client"
+)
+
+// The authenticated caller of a request, created from the claims in the validated access token.
+type Principal struct {
+	ClientId      string       `json:"client_id"`
+	Subject       string       `json:"sub"`
+	Scopes        []string     `json:"scope"`
+	OrgNrParent   string       `json:"helseid://claims/client/claims/orgnr_parent"`
+	OrgNrChild    string       `json:"helseid://claims/client/claims/orgnr_child"`
+	Pid           string       `json:"helseid://claims/identity/pid"`
+	SecurityLevel string       `json:"helseid://claims/identity/security_level"`
+	Amr           stringOrList `json:"amr"`
+	GrantType     string       `json:"gty"`
+	TokenType     TokenType    `json:"-"`
+	// the justification given by the caller if the request was let through with emergency access
+	EmergencyAccessReason string `json:"-"`
+}
+
+// Returns the organization number the data of the caller belongs to.
+// This is the child organization if the token has one, otherwise the parent organization.
+// Returns an empty string if the token does not identify an organization.
+func (p *Principal) TenantId() string {
+	if p.OrgNrChild != "" {
+		return p.OrgNrChild
+	}
+	return p.OrgNrParent
+}
+
+func (p *Principal) IsUser() bool {
+	return p.TokenType == TokenTypeUser
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the principal added to the request by one of the authentication middlewares.
+func PrincipalFromRequest(r *http.Request) (*Principal, bool) {
+	principal, ok := r.Context().Value(principalContextKey{}).(*Principal)
+	return principal, ok
+}
+
+func newPrincipal(token *jwt.JSONWebToken) (*Principal, error) {
+	principal := Principal{}
+	// signature already verified in getTokenFromAuthHeaderAndValidate
+	err := token.UnsafeClaimsWithoutVerification(&principal)
+	if err != nil {
+		return nil, err
+	}
+
+	principal.TokenType = classifyToken(&principal)
+
+	return &principal, nil
+}
+
+// A token issued with the client credentials grant is a client token. Otherwise the token
+// is a user token if it identifies an end-user (sub or pid) or how the user authenticated (amr).
+func classifyToken(principal *Principal) TokenType {
+	if principal.GrantType == "client_credentials" {
+		return TokenTypeClient
+	}
+
+	if principal.Subject != "" || principal.Pid != "" || len(principal.Amr) > 0 {
+		return TokenTypeUser
+	}
+
+	return TokenTypeClient
+}
+
+// A claim that can be either a single string or a list of strings.
+type stringOrList []string
+
+func (s *stringOrList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*s = stringOrList{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*s = list
+	return nil
+}
+
+func withPrincipal(r *http.Request, principal *Principal) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), principalContextKey{}, principal))
+}
@@ -0,0 +1,352 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A parser of the structured field values (RFC 8941) used in the Signature-Input, Signature and Content-Digest headers.
+// Bare items are parsed into string (string), sfToken (token), []byte (byte sequence), int64 (integer),
+// float64 (decimal) and bool (boolean).
+
+// A token, e.g. sha-256 in sha-256=:...:, to tell it apart from a string.
+type sfToken string
+
+// An item with parameters, e.g. "content-digest";sf
+type sfItem struct {
+	Value  interface{}
+	Params sfParams
+}
+
+// The parameters of an item or an inner list, in the order they were sent.
+type sfParams []sfParam
+
+type sfParam struct {
+	Name  string
+	Value interface{}
+}
+
+func (params sfParams) get(name string) (interface{}, bool) {
+	for _, param := range params {
+		if param.Name == name {
+			return param.Value, true
+		}
+	}
+	return nil, false
+}
+
+// A member of a dictionary. Value is a bare item, or []sfItem for an inner list.
+// Raw is the value and parameters as they were sent, e.g. the signature parameters covered by the signature.
+type sfMember struct {
+	Name   string
+	Value  interface{}
+	Params sfParams
+	Raw    string
+}
+
+type sfParser struct {
+	input string
+	pos   int
+}
+
+// Parses a dictionary (RFC 8941 section 4.2.2). Duplicate names are rejected.
+func parseDictionary(input string) ([]sfMember, error) {
+	p := &sfParser{input: strings.Trim(input, " ")}
+	if p.input == "" {
+		return nil, errors.New("empty dictionary")
+	}
+
+	members := []sfMember{}
+	for {
+		name, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range members {
+			if member.Name == name {
+				return nil, fmt.Errorf("duplicate dictionary member %v", name)
+			}
+		}
+
+		member := sfMember{Name: name, Value: true}
+		start := p.pos
+		if p.peek() == '=' {
+			p.pos++
+			start = p.pos
+			member.Value, member.Params, err = p.parseItemOrInnerList()
+		} else {
+			member.Params, err = p.parseParams()
+		}
+		if err != nil {
+			return nil, err
+		}
+		member.Raw = p.input[start:p.pos]
+		members = append(members, member)
+
+		p.skipOws()
+		if p.done() {
+			return members, nil
+		}
+		if p.peek() != ',' {
+			return nil, fmt.Errorf("unexpected %q in dictionary at position %v", p.peek(), p.pos)
+		}
+		p.pos++
+		p.skipOws()
+		if p.done() {
+			return nil, errors.New("dictionary ends with a comma")
+		}
+	}
+}
+
+// Parses an inner list with parameters that must be the whole input, e.g. ("@method" "@path");created=1618884473
+func parseInnerList(input string) ([]sfItem, sfParams, error) {
+	p := &sfParser{input: input}
+	if p.peek() != '(' {
+		return nil, nil, errors.New("not an inner list")
+	}
+
+	value, params, err := p.parseItemOrInnerList()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !p.done() {
+		return nil, nil, fmt.Errorf("unexpected %q after inner list", p.peek())
+	}
+	return value.([]sfItem), params, nil
+}
+
+func (p *sfParser) done() bool {
+	return p.pos >= len(p.input)
+}
+
+// returns 0 at the end of the input
+func (p *sfParser) peek() byte {
+	if p.done() {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *sfParser) skipSp() {
+	for p.peek() == ' ' {
+		p.pos++
+	}
+}
+
+func (p *sfParser) skipOws() {
+	for p.peek() == ' ' || p.peek() == '\t' {
+		p.pos++
+	}
+}
+
+func (p *sfParser) parseItemOrInnerList() (interface{}, sfParams, error) {
+	if p.peek() != '(' {
+		value, err := p.parseBareItem()
+		if err != nil {
+			return nil, nil, err
+		}
+		params, err := p.parseParams()
+		return value, params, err
+	}
+
+	p.pos++
+	items := []sfItem{}
+	for {
+		p.skipSp()
+		if p.peek() == ')' {
+			p.pos++
+			params, err := p.parseParams()
+			return items, params, err
+		}
+
+		value, err := p.parseBareItem()
+		if err != nil {
+			return nil, nil, err
+		}
+		params, err := p.parseParams()
+		if err != nil {
+			return nil, nil, err
+		}
+		items = append(items, sfItem{Value: value, Params: params})
+
+		if c := p.peek(); c != ' ' && c != ')' {
+			return nil, nil, errors.New("malformed inner list")
+		}
+	}
+}
+
+func (p *sfParser) parseParams() (sfParams, error) {
+	params := sfParams{}
+	for p.peek() == ';' {
+		p.pos++
+		p.skipSp()
+		name, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+
+		var value interface{} = true
+		if p.peek() == '=' {
+			p.pos++
+			value, err = p.parseBareItem()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// a later parameter with the same name replaces the earlier one
+		replaced := false
+		for i := range params {
+			if params[i].Name == name {
+				params[i].Value = value
+				replaced = true
+			}
+		}
+		if !replaced {
+			params = append(params, sfParam{Name: name, Value: value})
+		}
+	}
+	return params, nil
+}
+
+func (p *sfParser) parseKey() (string, error) {
+	start := p.pos
+	if c := p.peek(); !isLcAlpha(c) && c != '*' {
+		return "", fmt.Errorf("malformed key at position %v", p.pos)
+	}
+	for c := p.peek(); isLcAlpha(c) || isDigit(c) || strings.IndexByte("_-.*", c) != -1; c = p.peek() {
+		p.pos++
+	}
+	return p.input[start:p.pos], nil
+}
+
+func (p *sfParser) parseBareItem() (interface{}, error) {
+	c := p.peek()
+	switch {
+	case c == '-' || isDigit(c):
+		return p.parseNumber()
+	case c == '"':
+		return p.parseString()
+	case c == '*' || isAlpha(c):
+		return p.parseToken(), nil
+	case c == ':':
+		return p.parseByteSequence()
+	case c == '?':
+		return p.parseBoolean()
+	}
+	return nil, fmt.Errorf("malformed item at position %v", p.pos)
+}
+
+func (p *sfParser) parseNumber() (interface{}, error) {
+	start := p.pos
+	if p.peek() == '-' {
+		p.pos++
+	}
+	if !isDigit(p.peek()) {
+		return nil, errors.New("malformed number")
+	}
+
+	decimal := false
+	for c := p.peek(); isDigit(c) || (c == '.' && !decimal); c = p.peek() {
+		if c == '.' {
+			decimal = true
+		}
+		p.pos++
+	}
+	number := p.input[start:p.pos]
+
+	if decimal {
+		if strings.HasSuffix(number, ".") || len(strings.SplitN(strings.TrimPrefix(number, "-"), ".", 2)[0]) > 12 {
+			return nil, errors.New("malformed decimal")
+		}
+		return strconv.ParseFloat(number, 64)
+	}
+	if len(strings.TrimPrefix(number, "-")) > 15 {
+		return nil, errors.New("integer is too large")
+	}
+	return strconv.ParseInt(number, 10, 64)
+}
+
+// A string may only contain printable ASCII, and only " and \ are escaped with \
+func (p *sfParser) parseString() (string, error) {
+	p.pos++
+	var value strings.Builder
+	for !p.done() {
+		c := p.input[p.pos]
+		p.pos++
+		switch {
+		case c == '\\':
+			next := p.peek()
+			if next != '"' && next != '\\' {
+				return "", errors.New("malformed escape in string")
+			}
+			value.WriteByte(next)
+			p.pos++
+		case c == '"':
+			return value.String(), nil
+		case c < 0x20 || c > 0x7e:
+			return "", errors.New("invalid character in string")
+		default:
+			value.WriteByte(c)
+		}
+	}
+	return "", errors.New("unterminated string")
+}
+
+func (p *sfParser) parseToken() sfToken {
+	start := p.pos
+	for c := p.peek(); isTchar(c) || c == ':' || c == '/'; c = p.peek() {
+		p.pos++
+	}
+	return sfToken(p.input[start:p.pos])
+}
+
+func (p *sfParser) parseByteSequence() ([]byte, error) {
+	p.pos++
+	end := strings.IndexByte(p.input[p.pos:], ':')
+	if end == -1 {
+		return nil, errors.New("unterminated byte sequence")
+	}
+	encoded := p.input[p.pos : p.pos+end]
+	p.pos += end + 1
+
+	for i := 0; i < len(encoded); i++ {
+		if c := encoded[i]; !isAlpha(c) && !isDigit(c) && c != '+' && c != '/' && c != '=' {
+			return nil, errors.New("invalid character in byte sequence")
+		}
+	}
+	return base64.StdEncoding.DecodeString(encoded)
+}
+
+func (p *sfParser) parseBoolean() (bool, error) {
+	p.pos++
+	switch p.peek() {
+	case '1':
+		p.pos++
+		return true, nil
+	case '0':
+		p.pos++
+		return false, nil
+	}
+	return false, errors.New("malformed boolean")
+}
+
+func isLcAlpha(c byte) bool {
+	return c >= 'a' && c <= 'z'
+}
+
+func isAlpha(c byte) bool {
+	return isLcAlpha(c) || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// the characters allowed in a token (RFC 9110 section 5.6.2)
+func isTchar(c byte) bool {
+	return isAlpha(c) || isDigit(c) || strings.IndexByte("!#$%&'*+-.^_`|~", c) != -1
+}
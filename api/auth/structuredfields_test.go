@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDictionary(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []sfMember
+		wantErr bool
+	}{
+		{
+			name:  "byte sequences",
+			input: "sha-256=:AQID:, sha-512=:BAU=:",
+			want: []sfMember{
+				{Name: "sha-256", Value: []byte{1, 2, 3}, Params: sfParams{}, Raw: ":AQID:"},
+				{Name: "sha-512", Value: []byte{4, 5}, Params: sfParams{}, Raw: ":BAU=:"},
+			},
+		},
+		{
+			name:  "inner list with parameters",
+			input: `sig1=("@method" "@path";req);created=1618884473;keyid="a;b=c,d"`,
+			want: []sfMember{{
+				Name: "sig1",
+				Value: []sfItem{
+					{Value: "@method", Params: sfParams{}},
+					{Value: "@path", Params: sfParams{{Name: "req", Value: true}}},
+				},
+				Params: sfParams{{Name: "created", Value: int64(1618884473)}, {Name: "keyid", Value: "a;b=c,d"}},
+				Raw:    `("@method" "@path";req);created=1618884473;keyid="a;b=c,d"`,
+			}},
+		},
+		{
+			name:  "bare items",
+			input: `a=token/x:y, b="say \"hi\" \\", c=-12, d=1.5, e=?0, f`,
+			want: []sfMember{
+				{Name: "a", Value: sfToken("token/x:y"), Params: sfParams{}, Raw: "token/x:y"},
+				{Name: "b", Value: `say "hi" \`, Params: sfParams{}, Raw: `"say \"hi\" \\"`},
+				{Name: "c", Value: int64(-12), Params: sfParams{}, Raw: "-12"},
+				{Name: "d", Value: 1.5, Params: sfParams{}, Raw: "1.5"},
+				{Name: "e", Value: false, Params: sfParams{}, Raw: "?0"},
+				{Name: "f", Value: true, Params: sfParams{}, Raw: ""},
+			},
+		},
+		{name: "empty", input: "  ", wantErr: true},
+		{name: "uppercase key", input: "Sig1=:AQID:", wantErr: true},
+		{name: "duplicate key", input: "a=1, a=2", wantErr: true},
+		{name: "trailing comma", input: "a=1,", wantErr: true},
+		{name: "missing comma", input: "a=1 b=2", wantErr: true},
+		{name: "unterminated string", input: `a="abc`, wantErr: true},
+		{name: "invalid escape", input: `a="\n"`, wantErr: true},
+		{name: "non-ascii string", input: "a=\"æ\"", wantErr: true},
+		{name: "unterminated byte sequence", input: "a=:AQID", wantErr: true},
+		{name: "invalid byte sequence", input: "a=:AQ ID:", wantErr: true},
+		{name: "unterminated inner list", input: `a=("b" "c"`, wantErr: true},
+		{name: "inner list without space", input: `a=("b""c")`, wantErr: true},
+		{name: "integer too large", input: "a=1234567890123456", wantErr: true},
+		{name: "malformed boolean", input: "a=?2", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseDictionary(test.input)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("got %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package notes
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrNotFound = errors.New("note not found")
+
+// A clinical note about a patient.
+type Note struct {
+	Id        string `json:"id"`
+	PatientId string `json:"patientId"`
+	Title     string `json:"title"`
+	Text      string `json:"text"`
+	// the user or client that created the note
+	Author string `json:"author"`
+	// the user or client that last updated the note, the author until the note is updated
+	UpdatedBy string    `json:"updatedBy"`
+	Created   time.Time `json:"created"`
+	Updated   time.Time `json:"updated"`
+}
+
+// Stores notes partitioned by tenant, a tenant can only read and write its own notes.
+// Implement this interface to store the notes in a database instead of in memory.
+type Store interface {
+	List(tenantId string) ([]Note, error)
+	Get(tenantId, id string) (Note, error)
+	Create(tenantId string, note Note) (Note, error)
+	Update(tenantId string, note Note) (Note, error)
+	Delete(tenantId, id string) error
+}
+
+// A Store that keeps the notes in memory, all notes are lost when the API is stopped.
+type MemoryStore struct {
+	mutex sync.RWMutex
+	// notes by tenant id and note id
+	notes map[string]map[string]Note
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		notes: map[string]map[string]Note{},
+	}
+}
+
+func (s *MemoryStore) List(tenantId string) ([]Note, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	notes := []Note{}
+	for _, note := range s.notes[tenantId] {
+		notes = append(notes, note)
+	}
+	sort.Slice(notes, func(i, j int) bool {
+		return notes[i].Created.Before(notes[j].Created)
+	})
+
+	return notes, nil
+}
+
+func (s *MemoryStore) Get(tenantId, id string) (Note, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	note, ok := s.notes[tenantId][id]
+	if !ok {
+		return Note{}, ErrNotFound
+	}
+
+	return note, nil
+}
+
+func (s *MemoryStore) Create(tenantId string, note Note) (Note, error) {
+	id, err := generateId()
+	if err != nil {
+		return Note{}, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	note.Id = id
+	note.UpdatedBy = note.Author
+	note.Created = time.Now().UTC()
+	note.Updated = note.Created
+
+	if s.notes[tenantId] == nil {
+		s.notes[tenantId] = map[string]Note{}
+	}
+	s.notes[tenantId][note.Id] = note
+
+	return note, nil
+}
+
+func (s *MemoryStore) Update(tenantId string, note Note) (Note, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	existing, ok := s.notes[tenantId][note.Id]
+	if !ok {
+		return Note{}, ErrNotFound
+	}
+
+	// the author of the note is kept, the user or client updating the note is in UpdatedBy
+	note.Author = existing.Author
+	note.Created = existing.Created
+	note.Updated = time.Now().UTC()
+	s.notes[tenantId][note.Id] = note
+
+	return note, nil
+}
+
+func (s *MemoryStore) Delete(tenantId, id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.notes[tenantId][id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.notes[tenantId], id)
+
+	return nil
+}
+
+func generateId() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
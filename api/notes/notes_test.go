@@ -0,0 +1,65 @@
+package notes
+
+import "testing"
+
+func TestMemoryStoreTenantIsolation(t *testing.T) {
+	store := NewMemoryStore()
+	noteOfB, err := store.Create("tenant-b", Note{PatientId: "patient", Title: "B", Text: "the note of tenant B", Author: "user-b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		do   func() error
+	}{
+		{
+			name: "get",
+			do: func() error {
+				_, err := store.Get("tenant-a", noteOfB.Id)
+				return err
+			},
+		},
+		{
+			name: "update",
+			do: func() error {
+				_, err := store.Update("tenant-a", Note{Id: noteOfB.Id, Title: "A", Text: "changed by tenant A", UpdatedBy: "user-a"})
+				return err
+			},
+		},
+		{
+			name: "delete",
+			do: func() error {
+				return store.Delete("tenant-a", noteOfB.Id)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.do()
+			if err != ErrNotFound {
+				t.Errorf("got error %v, want %v", err, ErrNotFound)
+			}
+		})
+	}
+
+	t.Run("list", func(t *testing.T) {
+		notes, err := store.List("tenant-a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(notes) != 0 {
+			t.Errorf("got %v notes, want 0", len(notes))
+		}
+	})
+
+	// the note of tenant B is unchanged
+	got, err := store.Get("tenant-b", noteOfB.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != noteOfB {
+		t.Errorf("got %v, want %v", got, noteOfB)
+	}
+}
@@ -0,0 +1,41 @@
+package routes
+
+import (
+	"encoding/csv"
+	"hello-go-rest-api/audit"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Exports the emergency accesses that must be reviewed, as JSON or as CSV with ?format=csv
+func EmergencyAccessReport(w http.ResponseWriter, r *http.Request) {
+	report := audit.EmergencyAccess.Report()
+
+	if r.URL.Query().Get("format") != "csv" {
+		writeJson(w, http.StatusOK, report)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="emergency-access-report.csv"`)
+
+	csvWriter := csv.NewWriter(w)
+	csvWriter.Write([]string{"time", "clientId", "subject", "pid", "tenantId", "securityLevel", "method", "path", "requiredScope", "reason", "reviewRequired"})
+	for _, event := range report {
+		csvWriter.Write([]string{
+			event.Time.Format(time.RFC3339),
+			event.ClientId,
+			event.Subject,
+			event.Pid,
+			event.TenantId,
+			event.SecurityLevel,
+			event.Method,
+			event.Path,
+			event.RequiredScope,
+			event.Reason,
+			strconv.FormatBool(event.ReviewRequired),
+		})
+	}
+	csvWriter.Flush()
+}
@@ -0,0 +1,175 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"hello-go-rest-api/auth"
+	"hello-go-rest-api/notes"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// The store the notes endpoints read from and write to.
+// Replace it with an implementation of notes.Store backed by a database.
+var NoteStore notes.Store = notes.NewMemoryStore()
+
+// the fields of a note the client can set when creating or updating a note
+type noteInput struct {
+	PatientId string `json:"patientId"`
+	Title     string `json:"title"`
+	Text      string `json:"text"`
+}
+
+func ListNotes(w http.ResponseWriter, r *http.Request) {
+	tenantId, ok := getTenantId(w, r)
+	if !ok {
+		return
+	}
+
+	list, err := NoteStore.List(tenantId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJson(w, http.StatusOK, list)
+}
+
+func GetNote(w http.ResponseWriter, r *http.Request) {
+	tenantId, ok := getTenantId(w, r)
+	if !ok {
+		return
+	}
+
+	note, err := NoteStore.Get(tenantId, mux.Vars(r)["id"])
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	writeJson(w, http.StatusOK, note)
+}
+
+func CreateNote(w http.ResponseWriter, r *http.Request) {
+	tenantId, ok := getTenantId(w, r)
+	if !ok {
+		return
+	}
+
+	input, ok := readNoteInput(w, r)
+	if !ok {
+		return
+	}
+
+	principal, _ := auth.PrincipalFromRequest(r)
+	note, err := NoteStore.Create(tenantId, notes.Note{
+		PatientId: input.PatientId,
+		Title:     input.Title,
+		Text:      input.Text,
+		Author:    getAuthor(principal),
+	})
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	writeJson(w, http.StatusCreated, note)
+}
+
+func UpdateNote(w http.ResponseWriter, r *http.Request) {
+	tenantId, ok := getTenantId(w, r)
+	if !ok {
+		return
+	}
+
+	input, ok := readNoteInput(w, r)
+	if !ok {
+		return
+	}
+
+	principal, _ := auth.PrincipalFromRequest(r)
+	note, err := NoteStore.Update(tenantId, notes.Note{
+		Id:        mux.Vars(r)["id"],
+		PatientId: input.PatientId,
+		Title:     input.Title,
+		Text:      input.Text,
+		UpdatedBy: getAuthor(principal),
+	})
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	writeJson(w, http.StatusOK, note)
+}
+
+func DeleteNote(w http.ResponseWriter, r *http.Request) {
+	tenantId, ok := getTenantId(w, r)
+	if !ok {
+		return
+	}
+
+	err := NoteStore.Delete(tenantId, mux.Vars(r)["id"])
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Gets the tenant of the caller from the principal added by the auth middleware.
+// Responds with http error 403 forbidden if the access token does not identify an organization.
+func getTenantId(w http.ResponseWriter, r *http.Request) (string, bool) {
+	principal, ok := auth.PrincipalFromRequest(r)
+	if !ok {
+		http.Error(w, "request is not authenticated", http.StatusUnauthorized)
+		return "", false
+	}
+
+	tenantId := principal.TenantId()
+	if tenantId == "" {
+		http.Error(w, "access token does not contain an organization number", http.StatusForbidden)
+		return "", false
+	}
+
+	return tenantId, true
+}
+
+func getAuthor(principal *auth.Principal) string {
+	if principal.IsUser() {
+		return principal.Subject
+	}
+	return principal.ClientId
+}
+
+func readNoteInput(w http.ResponseWriter, r *http.Request) (noteInput, bool) {
+	input := noteInput{}
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		http.Error(w, "invalid note: "+err.Error(), http.StatusBadRequest)
+		return input, false
+	}
+
+	if input.PatientId == "" || input.Text == "" {
+		http.Error(w, "invalid note: patientId and text are required", http.StatusBadRequest)
+		return input, false
+	}
+
+	return input, true
+}
+
+func writeStoreError(w http.ResponseWriter, err error) {
+	if errors.Is(err, notes.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+func writeJson(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
@@ -9,14 +9,47 @@ import (
 	"github.com/urfave/negroni"
 )
 
+// Set to true to require that requests to /foo are signed with a HTTP Message Signature (RFC 9421).
+// Only the m2m app signs its requests, the web app will not be able to call /foo when this is enabled.
+const requireHttpMessageSignatures = false
+
+const readNotesScope = "norsk-helsenett:golang-sample-api/notes.read"
+const writeNotesScope = "norsk-helsenett:golang-sample-api/notes.write"
+const auditScope = "norsk-helsenett:golang-sample-api/audit"
+
+// the minimum security level required to use emergency access
+const emergencyAccessSecurityLevel = 4
+
 func StartServer() {
 	auth.RefreshHelseidMetadata()
+	auth.LoadTokenDecryptionKeys()
 
 	r := mux.NewRouter()
 
-	r.Handle("/foo", negroni.New(
+	fooMiddlewares := negroni.New(
 		negroni.HandlerFunc(auth.IsAuthenticatedAndAuthorizedMiddleware("norsk-helsenett:golang-sample-api/foo")),
-		negroni.Wrap(http.HandlerFunc(routes.Foo)),
+	)
+	if requireHttpMessageSignatures {
+		fooMiddlewares.Use(negroni.HandlerFunc(auth.HttpMessageSignatureMiddleware))
+	}
+	fooMiddlewares.UseHandler(http.HandlerFunc(routes.Foo))
+	r.Handle("/foo", fooMiddlewares).Methods("GET")
+
+	// in an emergency health personnel can read notes without the read scope, see auth.EmergencyAccessReasonHeader
+	readNotes := negroni.HandlerFunc(auth.IsAuthenticatedAndAuthorizedOrEmergencyAccessMiddleware(readNotesScope, emergencyAccessSecurityLevel))
+	writeNotes := negroni.HandlerFunc(auth.IsAuthenticatedAndAuthorizedMiddleware(writeNotesScope))
+	userToken := negroni.HandlerFunc(auth.RequireUserTokenMiddleware)
+
+	r.Handle("/notes", negroni.New(readNotes, negroni.Wrap(http.HandlerFunc(routes.ListNotes)))).Methods("GET")
+	r.Handle("/notes/{id}", negroni.New(readNotes, negroni.Wrap(http.HandlerFunc(routes.GetNote)))).Methods("GET")
+	// notes are written by health personnel, so an end-user must be present
+	r.Handle("/notes", negroni.New(writeNotes, userToken, negroni.Wrap(http.HandlerFunc(routes.CreateNote)))).Methods("POST")
+	r.Handle("/notes/{id}", negroni.New(writeNotes, userToken, negroni.Wrap(http.HandlerFunc(routes.UpdateNote)))).Methods("PUT")
+	r.Handle("/notes/{id}", negroni.New(writeNotes, userToken, negroni.Wrap(http.HandlerFunc(routes.DeleteNote)))).Methods("DELETE")
+
+	r.Handle("/audit/emergency-access", negroni.New(
+		negroni.HandlerFunc(auth.IsAuthenticatedAndAuthorizedMiddleware(auditScope)),
+		negroni.Wrap(http.HandlerFunc(routes.EmergencyAccessReport)),
 	)).Methods("GET")
 
 	http.ListenAndServe(":3123", r)
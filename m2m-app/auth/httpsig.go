@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"gopkg.in/square/go-jose.v2"
+)
+
+// the components covered by the HTTP Message Signature (RFC 9421)
+var signatureComponents = []string{"@method", "@path", "content-digest", "authorization"}
+
+// A http.RoundTripper that adds a Content-Digest header (RFC 9530) and
+// a HTTP Message Signature (RFC 9421) to every request before sending it with base.
+// It must run after the Authorization header is set, since the header is covered by the signature.
+type httpMessageSigner struct {
+	key  jose.JSONWebKey
+	base http.RoundTripper
+}
+
+func newHttpMessageSigner(key jose.JSONWebKey, base http.RoundTripper) *httpMessageSigner {
+	return &httpMessageSigner{
+		key:  key,
+		base: base,
+	}
+}
+
+func (s *httpMessageSigner) RoundTrip(r *http.Request) (*http.Response, error) {
+	body := []byte{}
+	if r.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// a RoundTripper must not modify the original request
+	req := r.Clone(r.Context())
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+
+	digest := sha256.Sum256(body)
+	req.Header.Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(digest[:])+":")
+
+	signatureParams := fmt.Sprintf(`("%v");created=%d;keyid="%v";alg="rsa-pss-sha512"`,
+		strings.Join(signatureComponents, `" "`), time.Now().Unix(), s.key.KeyID)
+
+	signature, err := s.sign(createSignatureBase(req, signatureParams))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Signature-Input", "sig1="+signatureParams)
+	req.Header.Set("Signature", "sig1=:"+base64.StdEncoding.EncodeToString(signature)+":")
+
+	return s.base.RoundTrip(req)
+}
+
+func (s *httpMessageSigner) sign(signatureBase string) ([]byte, error) {
+	privateKey, ok := s.key.Key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("http message signatures require a RSA private key")
+	}
+
+	hash := sha512.Sum512([]byte(signatureBase))
+	return rsa.SignPSS(rand.Reader, privateKey, crypto.SHA512, hash[:], &rsa.PSSOptions{SaltLength: 64})
+}
+
+// Creates the signature base as defined in RFC 9421 section 2.5.
+func createSignatureBase(r *http.Request, signatureParams string) string {
+	var base strings.Builder
+	for _, component := range signatureComponents {
+		var value string
+		switch component {
+		case "@method":
+			value = strings.ToUpper(r.Method)
+		case "@path":
+			value = r.URL.EscapedPath()
+		default:
+			value = strings.TrimSpace(r.Header.Get(component))
+		}
+		fmt.Fprintf(&base, "\"%v\": %v\n", component, value)
+	}
+	fmt.Fprintf(&base, "\"@signature-params\": %v", signatureParams)
+
+	return base.String()
+}
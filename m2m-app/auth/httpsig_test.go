@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// A http.RoundTripper that keeps the request instead of sending it.
+type capturingRoundTripper struct {
+	request *http.Request
+}
+
+func (c *capturingRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	c.request = r
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+		Request:    r,
+	}, nil
+}
+
+func TestHttpMessageSigner(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+	}{
+		{name: "post with body", method: "POST", url: "https://localhost:5001/api/notes", body: `{"title":"Note"}`},
+		{name: "get without body", method: "GET", url: "https://localhost:5001/api/notes"},
+		{name: "escaped path", method: "DELETE", url: "https://localhost:5001/api/notes/a%20b?x=1"},
+	}
+
+	key := getPrivateKey()
+	publicKey := key.Public().Key.(*rsa.PublicKey)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var body io.Reader
+			if test.body != "" {
+				body = strings.NewReader(test.body)
+			}
+			r, err := http.NewRequest(test.method, test.url, body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Header.Set("Authorization", "Bearer access-token")
+
+			captured := &capturingRoundTripper{}
+			_, err = newHttpMessageSigner(key, captured).RoundTrip(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			signed := captured.request
+
+			if r.Header.Get("Signature") != "" {
+				t.Error("the original request was modified")
+			}
+
+			sent, _ := ioutil.ReadAll(signed.Body)
+			if string(sent) != test.body {
+				t.Errorf("got body %v, want %v", string(sent), test.body)
+			}
+
+			digest := sha256.Sum256([]byte(test.body))
+			wantDigest := "sha-256=:" + base64.StdEncoding.EncodeToString(digest[:]) + ":"
+			if signed.Header.Get("Content-Digest") != wantDigest {
+				t.Errorf("got Content-Digest %v, want %v", signed.Header.Get("Content-Digest"), wantDigest)
+			}
+
+			signatureInput := signed.Header.Get("Signature-Input")
+			if !strings.HasPrefix(signatureInput, `sig1=("@method" "@path" "content-digest" "authorization");created=`) ||
+				!strings.Contains(signatureInput, `;keyid="`+key.KeyID+`";alg="rsa-pss-sha512"`) {
+				t.Errorf("unexpected Signature-Input %v", signatureInput)
+			}
+
+			signatureHeader := signed.Header.Get("Signature")
+			if !strings.HasPrefix(signatureHeader, "sig1=:") || !strings.HasSuffix(signatureHeader, ":") {
+				t.Fatalf("unexpected Signature %v", signatureHeader)
+			}
+			signature, err := base64.StdEncoding.DecodeString(strings.TrimSuffix(strings.TrimPrefix(signatureHeader, "sig1=:"), ":"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			signatureBase := createSignatureBase(signed, strings.TrimPrefix(signatureInput, "sig1="))
+			hash := sha512.Sum512([]byte(signatureBase))
+			err = rsa.VerifyPSS(publicKey, crypto.SHA512, hash[:], signature, &rsa.PSSOptions{SaltLength: 64})
+			if err != nil {
+				t.Errorf("signature verification failed: %v", err)
+			}
+		})
+	}
+}
+
+// The api verifies a copy of the same request in api/auth/testdata, so both sides must create the same signature base from it.
+// Update both copies if the signer changes.
+func TestCreateSignatureBaseMatchesApi(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/m2m-app-signed-request.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fixture := struct {
+		Method        string            `json:"method"`
+		Url           string            `json:"url"`
+		Headers       map[string]string `json:"headers"`
+		Body          string            `json:"body"`
+		SignatureBase string            `json:"signatureBase"`
+	}{}
+	err = json.Unmarshal(data, &fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := http.NewRequest(fixture.Method, fixture.Url, strings.NewReader(fixture.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range fixture.Headers {
+		r.Header.Set(name, value)
+	}
+
+	got := createSignatureBase(r, strings.TrimPrefix(fixture.Headers["Signature-Input"], "sig1="))
+	if got != fixture.SignatureBase {
+		t.Errorf("got signature base\n%v\nwant\n%v", got, fixture.SignatureBase)
+	}
+}
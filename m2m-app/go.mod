@@ -4,5 +4,5 @@ go 1.16
 
 require (
 	golang.org/x/oauth2 v0.0.0-20210628180205-a41e5a781914
-	gopkg.in/square/go-jose.v2 v2.6.0 // indirect
+	gopkg.in/square/go-jose.v2 v2.6.0
 )
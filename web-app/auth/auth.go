@@ -6,13 +6,17 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"log"
 	"math"
 	"net/http"
+	"os"
+	"sort"
 	"strings"
 	"time"
 
 	oidc "github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gorilla/sessions"
 	"golang.org/x/oauth2"
 	"gopkg.in/square/go-jose.v2"
 	"gopkg.in/square/go-jose.v2/jwt"
@@ -22,22 +26,72 @@ import (
 
 const ClientId = "golang-web-app"
 
-var scopes = []string{"openid", "profile", "norsk-helsenett:golang-sample-api/foo"}
+var scopes = []string{"openid", "profile"}
+
+// The APIs the web app calls, by id. The user is asked to consent to the scopes of all the APIs at login.
+// Resource is the name of the API at HelseID, and is sent as the resource parameter (RFC 8707)
+// to get an access token with the API as the audience. Url is where the API is hosted.
+var Apis = map[string]Api{
+	"sample-api": {
+		Resource: "norsk-helsenett:golang-sample-api",
+		Scopes: []string{
+			"norsk-helsenett:golang-sample-api/foo",
+			"norsk-helsenett:golang-sample-api/notes.read",
+			"norsk-helsenett:golang-sample-api/notes.write",
+		},
+		Url: "http://localhost:3123",
+	},
+}
+
+// the API the access token received at login is issued for, tokens for the other APIs are requested with the refresh token
+const DefaultApi = "sample-api"
+
+// request a refresh token (scope offline_access) to renew the access token without a new login
+const requestOfflineAccess = true
 
 const redirectLoginUrl = "http://localhost:44123/callback"
 const RedirectLogoutUrl = "http://localhost:44123"
 const authorizationServerMetadataUrl = "https://helseid-sts.utvikling.nhn.no/.well-known/openid-configuration"
 
+// send the request object to HelseID with a pushed authorization request (PAR) instead of in the redirect url
+const UsePushedAuthorizationRequests = true
+
+// bind the tokens to a key pair of the session with DPoP (RFC 9449) instead of using bearer tokens
+const UseDPoP = true
+
+// How the user page detects that the HelseID session has ended, and sends the user back to the home page:
+// "status" polls /session/status, which is inactive when the session has been destroyed by back-channel or front-channel logout
+// "check_session_iframe" uses the check_session_iframe of HelseID (OpenID Connect Session Management 1.0)
+// "" disables session monitoring
+const SessionMonitoring = "status"
+
+// fetch claims from the userinfo endpoint after login, and add them to the claims of the id token
+const FetchUserInfo = true
+
+// Set the environment variable ENVIRONMENT to "development" to enable the pages that are only for developers,
+// e.g. /dev/tokens which shows the decoded tokens of the user. They are disabled for any other value.
+var DevelopmentMode = os.Getenv("ENVIRONMENT") == "development"
+
 const stateLength = 64
 const nonceLength = 64
 const codeVerifierLength = 64
 
+type Api struct {
+	Resource string
+	Scopes   []string
+	Url      string
+}
+
 // add fields to this struct to fetch the corresponding value from the well-known endpoint
 type authorizationServerMetadata struct {
 	Issuer                 string
 	Authorization_endpoint string
 	Token_endpoint         string
 	End_session_endpoint   string
+	Userinfo_endpoint      string
+
+	Pushed_authorization_request_endpoint string
+	Check_session_iframe                  string
 }
 
 var HelseidMetadata authorizationServerMetadata
@@ -76,7 +130,7 @@ func NewAuthenticator() (*Authenticator, error) {
 		ClientID:    ClientId,
 		RedirectURL: redirectLoginUrl,
 		Endpoint:    provider.Endpoint(),
-		Scopes:      scopes,
+		Scopes:      getScopes(),
 	}
 
 	return &Authenticator{
@@ -86,14 +140,81 @@ func NewAuthenticator() (*Authenticator, error) {
 	}, nil
 }
 
-func NewClient(accessTokenString string) *http.Client {
-	token := oauth2.Token{
-		AccessToken: accessTokenString,
+// Creates a client that adds an access token for the API with the id apiId to the requests.
+// When DPoP is enabled a new DPoP proof is added to every request.
+// The access token received at login is used for DefaultApi, for the other APIs a token is requested with the refresh token
+// the first time the client is used. An expired access token is refreshed with the refresh token in the session,
+// the new tokens are saved in session.Values and the caller must save the session afterwards.
+func NewClient(session *sessions.Session, apiId string) (*http.Client, error) {
+	api, ok := Apis[apiId]
+	if !ok {
+		return nil, fmt.Errorf("unknown api %v", apiId)
 	}
 
-	authenticator, _ := NewAuthenticator()
+	return newSessionClient(session, api.Resource)
+}
 
-	return authenticator.Config.Client(authenticator.Ctx, &token)
+// Creates a client that adds an access token for the resource indicator to the requests,
+// or an access token without a resource indicator if resource is empty.
+func newSessionClient(session *sessions.Session, resource string) (*http.Client, error) {
+	tokenSource := oauth2.ReuseTokenSource(nil, &sessionTokenSource{
+		session:  session,
+		resource: resource,
+	})
+
+	if !UseDPoP {
+		return oauth2.NewClient(context.Background(), tokenSource), nil
+	}
+
+	key, err := getDPoPKey(session)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Client{
+		Transport: &dpopTransport{
+			key:         key,
+			tokenSource: tokenSource,
+			base:        http.DefaultTransport,
+		},
+	}, nil
+}
+
+// The scopes to request at login: the scopes in scopes, the scopes of all APIs, and offline_access to get a refresh token.
+func getScopes() []string {
+	allScopes := append([]string{}, scopes...)
+	for _, api := range getApis() {
+		allScopes = append(allScopes, api.Scopes...)
+	}
+
+	if requestOfflineAccess {
+		allScopes = append(allScopes, "offline_access")
+	}
+	return allScopes
+}
+
+// The resource indicators of all APIs, sent at login so the refresh token can be used to get tokens for all of them.
+func getResources() []string {
+	resources := []string{}
+	for _, api := range getApis() {
+		resources = append(resources, api.Resource)
+	}
+	return resources
+}
+
+// Returns the APIs sorted by id, so the order of the scopes and resources in the requests does not change.
+func getApis() []Api {
+	ids := []string{}
+	for id := range Apis {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	apis := []Api{}
+	for _, id := range ids {
+		apis = append(apis, Apis[id])
+	}
+	return apis
 }
 
 func GenerateState() (string, error) {
@@ -158,7 +279,23 @@ func GenerateClientAssertionToken() (string, error) {
 	return raw, nil
 }
 
-func GenerateRequestObject(state, nonce, codeChallenge string) (string, error) {
+// Optional parameters of the authorization request.
+type AuthorizationRequestOptions struct {
+	// the user must authenticate with one of these authentication context classes (acr_values)
+	AcrValues []string
+	// the user must have authenticated within this time (max_age), ignored if zero
+	MaxAge time.Duration
+	// e.g. "login" to make the user log in again even if the user has a session at HelseID (prompt)
+	Prompt string
+	// e.g. the organization a multi-tenant client logs the user in on behalf of (authorization_details)
+	AuthorizationDetails []interface{}
+	// the languages of the user, so HelseID shows the login in the same language as the app (ui_locales)
+	UiLocales []string
+	// a hint about who the user is, passed on to the identity provider (login_hint)
+	LoginHint string
+}
+
+func GenerateRequestObject(state, nonce, codeChallenge string, options AuthorizationRequestOptions) (string, error) {
 
 	jti, err := generateRandomString(24)
 	if err != nil {
@@ -179,6 +316,13 @@ func GenerateRequestObject(state, nonce, codeChallenge string) (string, error) {
 		Nonce                 string           `json:"nonce"`
 		Code_challenge        string           `json:"code_challenge"`
 		Code_challenge_method string           `json:"code_challenge_method"`
+		Acr_values            string           `json:"acr_values,omitempty"`
+		Max_age               int64            `json:"max_age,omitempty"`
+		Prompt                string           `json:"prompt,omitempty"`
+		Authorization_details []interface{}    `json:"authorization_details,omitempty"`
+		Resource              []string         `json:"resource,omitempty"`
+		Ui_locales            string           `json:"ui_locales,omitempty"`
+		Login_hint            string           `json:"login_hint,omitempty"`
 	}{
 		Id:                    jti,
 		NotBefore:             jwt.NewNumericDate(time.Now()),
@@ -188,11 +332,18 @@ func GenerateRequestObject(state, nonce, codeChallenge string) (string, error) {
 		Aud:                   HelseidMetadata.Issuer,
 		Response_type:         "code",
 		Redirect_uri:          redirectLoginUrl,
-		Scope:                 strings.Join(scopes, " "),
+		Scope:                 strings.Join(getScopes(), " "),
 		State:                 state,
 		Nonce:                 nonce,
 		Code_challenge:        codeChallenge,
 		Code_challenge_method: "S256",
+		Acr_values:            strings.Join(options.AcrValues, " "),
+		Max_age:               int64(options.MaxAge.Seconds()),
+		Prompt:                options.Prompt,
+		Authorization_details: options.AuthorizationDetails,
+		Resource:              getResources(),
+		Ui_locales:            strings.Join(options.UiLocales, " "),
+		Login_hint:            options.LoginHint,
 	}
 
 	raw, err := generateSignedJwt(claims)
@@ -203,6 +354,23 @@ func GenerateRequestObject(state, nonce, codeChallenge string) (string, error) {
 	return raw, nil
 }
 
+// Returns the claims of an access token without verifying the signature. Only use this for tokens
+// received directly from the token endpoint of HelseID, the API must verify the tokens it receives.
+func AccessTokenClaims(accessToken string) (map[string]interface{}, error) {
+	token, err := jwt.ParseSigned(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := map[string]interface{}{}
+	err = token.UnsafeClaimsWithoutVerification(&claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
 func generateSignedJwt(claims interface{}) (string, error) {
 	if jwtSigner == nil {
 		var err error
@@ -0,0 +1,243 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"golang.org/x/oauth2"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// Nonces received in DPoP-Nonce headers, by the origin of the server that sent them.
+var dpopNonces = map[string]string{}
+var dpopNoncesMutex sync.Mutex
+
+// Gets the DPoP key pair of the session, a new key pair is created and saved in session.Values
+// if the session does not have one. The caller must save the session afterwards.
+func getDPoPKey(session *sessions.Session) (*ecdsa.PrivateKey, error) {
+	if keyJson, ok := session.Values["dpop_key"].(string); ok {
+		jwk := jose.JSONWebKey{}
+		err := jwk.UnmarshalJSON([]byte(keyJson))
+		if err != nil {
+			return nil, err
+		}
+
+		key, ok := jwk.Key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("the DPoP key in session is not an ECDSA private key")
+		}
+		return key, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	keyJson, err := jose.JSONWebKey{Key: key, Algorithm: string(jose.ES256), Use: "sig"}.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	session.Values["dpop_key"] = string(keyJson)
+
+	return key, nil
+}
+
+// Returns a context to use for token requests for the session. When DPoP is enabled the context
+// contains a http client that adds a DPoP proof created with the key pair of the session to the requests.
+func NewTokenRequestContext(ctx context.Context, session *sessions.Session) (context.Context, error) {
+	if !UseDPoP {
+		return ctx, nil
+	}
+
+	key, err := getDPoPKey(session)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{
+		Transport: &dpopTransport{
+			key:  key,
+			base: http.DefaultTransport,
+		},
+	}
+
+	return context.WithValue(ctx, oauth2.HTTPClient, client), nil
+}
+
+// A http.RoundTripper that adds a DPoP proof (RFC 9449) to every request.
+// If tokenSource is set the access token is added to the Authorization header with the DPoP scheme,
+// and the proof is bound to the access token.
+// If a resource server responds with a use_dpop_nonce error the request is sent again with the new nonce.
+// Token requests are not sent again here, since the body contains a client assertion that can only be used once,
+// postWithClientAssertion sends them again with a new client assertion.
+type dpopTransport struct {
+	key         *ecdsa.PrivateKey
+	tokenSource oauth2.TokenSource
+	base        http.RoundTripper
+}
+
+func (t *dpopTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	body := []byte{}
+	if r.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	accessToken := ""
+	if t.tokenSource != nil {
+		token, err := t.tokenSource.Token()
+		if err != nil {
+			return nil, err
+		}
+		accessToken = token.AccessToken
+	}
+
+	origin := r.URL.Scheme + "://" + r.URL.Host
+	resp, err := t.send(r, body, accessToken, getDPoPNonce(origin))
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := resp.Header.Get("DPoP-Nonce")
+	if nonce == "" {
+		return resp, nil
+	}
+	setDPoPNonce(origin, nonce)
+
+	if t.tokenSource == nil {
+		return resp, nil
+	}
+
+	retry, err := isUseDPoPNonceError(resp)
+	if err != nil || !retry {
+		return resp, err
+	}
+	resp.Body.Close()
+
+	return t.send(r, body, accessToken, nonce)
+}
+
+func (t *dpopTransport) send(r *http.Request, body []byte, accessToken, nonce string) (*http.Response, error) {
+	// a RoundTripper must not modify the original request
+	req := r.Clone(r.Context())
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+
+	proof, err := createDPoPProof(t.key, req.Method, req.URL, nonce, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("DPoP", proof)
+
+	if accessToken != "" {
+		req.Header.Set("Authorization", "DPoP "+accessToken)
+	}
+
+	return t.base.RoundTrip(req)
+}
+
+// Checks if the server rejected the request because the proof did not contain the nonce it requires.
+// The token endpoint responds with 400 and the error in the body,
+// a resource server responds with 401 and the error in the WWW-Authenticate header.
+func isUseDPoPNonceError(resp *http.Response) (bool, error) {
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		return strings.Contains(resp.Header.Get("WWW-Authenticate"), "use_dpop_nonce"), nil
+	case http.StatusBadRequest:
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return false, err
+		}
+		// put the body back in case the response is returned to the caller
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		var tokenError struct {
+			Error string `json:"error"`
+		}
+		json.Unmarshal(body, &tokenError)
+		return tokenError.Error == "use_dpop_nonce", nil
+	}
+
+	return false, nil
+}
+
+// Creates a DPoP proof for a request to the url with the http method.
+// If accessToken is not empty the proof contains the hash of the access token (ath).
+func createDPoPProof(key *ecdsa.PrivateKey, method string, requestUrl *url.URL, nonce, accessToken string) (string, error) {
+	signingKey := jose.SigningKey{
+		Algorithm: jose.ES256,
+		Key:       key,
+	}
+	options := (&jose.SignerOptions{EmbedJWK: true}).WithType("dpop+jwt")
+	signer, err := jose.NewSigner(signingKey, options)
+	if err != nil {
+		return "", err
+	}
+
+	jti, err := generateRandomString(24)
+	if err != nil {
+		return "", err
+	}
+
+	// the htu claim is the url without query and fragment, with the path escaped as it is sent,
+	// since the resource server compares it with the escaped path of the request
+	htu := requestUrl.Scheme + "://" + requestUrl.Host + requestUrl.EscapedPath()
+
+	claims := struct {
+		Id       string           `json:"jti"`
+		Method   string           `json:"htm"`
+		Url      string           `json:"htu"`
+		IssuedAt *jwt.NumericDate `json:"iat"`
+		Nonce    string           `json:"nonce,omitempty"`
+		Ath      string           `json:"ath,omitempty"`
+	}{
+		Id:       jti,
+		Method:   method,
+		Url:      htu,
+		IssuedAt: jwt.NewNumericDate(time.Now()),
+		Nonce:    nonce,
+	}
+
+	if accessToken != "" {
+		hash := sha256.Sum256([]byte(accessToken))
+		claims.Ath = base64.RawURLEncoding.EncodeToString(hash[:])
+	}
+
+	return jwt.Signed(signer).Claims(claims).CompactSerialize()
+}
+
+func getDPoPNonce(origin string) string {
+	dpopNoncesMutex.Lock()
+	defer dpopNoncesMutex.Unlock()
+	return dpopNonces[origin]
+}
+
+func setDPoPNonce(origin, nonce string) {
+	dpopNoncesMutex.Lock()
+	defer dpopNoncesMutex.Unlock()
+	dpopNonces[origin] = nonce
+}
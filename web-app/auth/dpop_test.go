@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/url"
+	"testing"
+
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func TestCreateDPoPProofHtu(t *testing.T) {
+	tests := []struct {
+		name       string
+		requestUrl string
+		wantHtu    string
+	}{
+		{name: "plain path", requestUrl: "https://localhost:5001/api/notes", wantHtu: "https://localhost:5001/api/notes"},
+		{name: "query and fragment are removed", requestUrl: "https://localhost:5001/api/notes?page=2#top", wantHtu: "https://localhost:5001/api/notes"},
+		{name: "escaped space", requestUrl: "https://localhost:5001/api/notes/a%20b", wantHtu: "https://localhost:5001/api/notes/a%20b"},
+		{name: "escaped slash", requestUrl: "https://localhost:5001/api/notes/a%2Fb", wantHtu: "https://localhost:5001/api/notes/a%2Fb"},
+		{name: "escaped unreserved character", requestUrl: "https://localhost:5001/api/notes/%7Ea", wantHtu: "https://localhost:5001/api/notes/%7Ea"},
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requestUrl, err := url.Parse(test.requestUrl)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			proof, err := createDPoPProof(key, "GET", requestUrl, "", "access-token")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			token, err := jwt.ParseSigned(proof)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var claims struct {
+				Url string `json:"htu"`
+			}
+			err = token.Claims(&key.PublicKey, &claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the resource server compares htu with the scheme, host and escaped path of the request
+			if claims.Url != test.wantHtu {
+				t.Errorf("got htu %v, want %v", claims.Url, test.wantHtu)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	oidc "github.com/coreos/go-oidc/v3/oidc"
+)
+
+const backchannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+// how old a logout token can be before it is rejected
+const maxLogoutTokenAge = 5 * time.Minute
+
+// The ids (jti) of the logout tokens received within maxLogoutTokenAge, to prevent replay.
+var usedLogoutTokens = map[string]time.Time{}
+var usedLogoutTokensMutex sync.Mutex
+
+// The claims of a validated logout token identifying which sessions to end.
+// At least one of Sid and Sub is set.
+type LogoutToken struct {
+	Sid string
+	Sub string
+	Jti string
+}
+
+// Validates a logout token sent by HelseID to the back-channel logout endpoint (OpenID Connect Back-Channel Logout 1.0).
+// The signature, issuer and audience are verified as for an id token, in addition the token must
+// contain the back-channel logout event and a sid or sub, must not contain a nonce, and can only be used once.
+// The token is not recorded as used, call MarkLogoutTokenAsUsed when the sessions have been destroyed,
+// so HelseID can send the token again if destroying the sessions failed.
+func VerifyLogoutToken(ctx context.Context, rawLogoutToken string) (*LogoutToken, error) {
+	authenticator, err := NewAuthenticator()
+	if err != nil {
+		return nil, err
+	}
+
+	// logout tokens are not required to have an expiry, the age is checked with iat below
+	verifier := authenticator.Provider.Verifier(&oidc.Config{
+		ClientID:        ClientId,
+		SkipExpiryCheck: true,
+	})
+	token, err := verifier.Verify(ctx, rawLogoutToken)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims struct {
+		Sid    string                     `json:"sid"`
+		Jti    string                     `json:"jti"`
+		Nonce  *string                    `json:"nonce"`
+		Events map[string]json.RawMessage `json:"events"`
+	}
+	err = token.Claims(&claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := claims.Events[backchannelLogoutEvent]; !ok {
+		return nil, errors.New("logout token does not contain the back-channel logout event")
+	}
+	if claims.Sid == "" && token.Subject == "" {
+		return nil, errors.New("logout token must contain sid or sub")
+	}
+	// a nonce is not allowed, to prevent an id token from being used as a logout token
+	if claims.Nonce != nil {
+		return nil, errors.New("logout token must not contain a nonce")
+	}
+	if time.Since(token.IssuedAt) > maxLogoutTokenAge {
+		return nil, errors.New("logout token is too old")
+	}
+	if !token.Expiry.IsZero() && token.Expiry.Before(time.Now()) {
+		return nil, errors.New("logout token is expired")
+	}
+	if claims.Jti == "" {
+		return nil, errors.New("logout token must contain jti")
+	}
+	if isLogoutTokenUsed(claims.Jti) {
+		return nil, errors.New("logout token has already been used")
+	}
+
+	return &LogoutToken{
+		Sid: claims.Sid,
+		Sub: token.Subject,
+		Jti: claims.Jti,
+	}, nil
+}
+
+// Records that the sessions of the logout token have been destroyed, so the token can not be used again.
+func MarkLogoutTokenAsUsed(logoutToken *LogoutToken) {
+	usedLogoutTokensMutex.Lock()
+	defer usedLogoutTokensMutex.Unlock()
+
+	for usedJti, usedAt := range usedLogoutTokens {
+		if time.Since(usedAt) > 2*maxLogoutTokenAge {
+			delete(usedLogoutTokens, usedJti)
+		}
+	}
+
+	usedLogoutTokens[logoutToken.Jti] = time.Now()
+}
+
+func isLogoutTokenUsed(jti string) bool {
+	usedLogoutTokensMutex.Lock()
+	defer usedLogoutTokensMutex.Unlock()
+
+	_, ok := usedLogoutTokens[jti]
+	return ok
+}
@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// Starts a server acting as HelseID with the discovery document and the keys used to verify the logout tokens.
+func newTestIssuer(key *rsa.PrivateKey) *httptest.Server {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                 server.URL,
+			"authorization_endpoint": server.URL + "/connect/authorize",
+			"token_endpoint":         server.URL + "/connect/token",
+			"jwks_uri":               server.URL + "/.well-known/openid-configuration/jwks",
+		})
+	})
+	mux.HandleFunc("/.well-known/openid-configuration/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "test-key", Algorithm: "RS256", Use: "sig"},
+		}})
+	})
+
+	return server
+}
+
+func createLogoutToken(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: key},
+		(&jose.SignerOptions{}).WithType("logout+jwt").WithHeader("kid", "test-key"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := jwt.Signed(signer).Claims(claims).CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestVerifyLogoutToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anotherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuer := newTestIssuer(key)
+	defer issuer.Close()
+	defer func(metadata authorizationServerMetadata) { HelseidMetadata = metadata }(HelseidMetadata)
+	HelseidMetadata.Issuer = issuer.URL
+
+	// the token ids are remembered when a token is used, so they must be unique for each run of the test
+	run := strconv.FormatInt(time.Now().UnixNano(), 36)
+	validClaims := func(jti string) map[string]interface{} {
+		return map[string]interface{}{
+			"iss":    issuer.URL,
+			"aud":    ClientId,
+			"iat":    time.Now().Unix(),
+			"jti":    jti + "-" + run,
+			"sid":    "helseid-session",
+			"sub":    "user",
+			"events": map[string]interface{}{backchannelLogoutEvent: map[string]interface{}{}},
+		}
+	}
+	withClaim := func(jti, name string, value interface{}) map[string]interface{} {
+		claims := validClaims(jti)
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name    string
+		key     *rsa.PrivateKey
+		claims  map[string]interface{}
+		wantSid string
+		wantSub string
+		wantErr bool
+	}{
+		{name: "valid", key: key, claims: validClaims("valid"), wantSid: "helseid-session", wantSub: "user"},
+		{name: "only sub", key: key, claims: withClaim("only-sub", "sid", nil), wantSub: "user"},
+		{name: "only sid", key: key, claims: withClaim("only-sid", "sub", nil), wantSid: "helseid-session"},
+		{
+			name: "missing sid and sub",
+			key:  key,
+			claims: func() map[string]interface{} {
+				claims := withClaim("no-sid-or-sub", "sid", nil)
+				delete(claims, "sub")
+				return claims
+			}(),
+			wantErr: true,
+		},
+		{name: "missing event", key: key, claims: withClaim("no-event", "events", nil), wantErr: true},
+		{
+			name:    "another event",
+			key:     key,
+			claims:  withClaim("another-event", "events", map[string]interface{}{"http://schemas.openid.net/event/other": map[string]interface{}{}}),
+			wantErr: true,
+		},
+		{name: "nonce present", key: key, claims: withClaim("nonce", "nonce", "n-0S6_WzA2Mj"), wantErr: true},
+		{name: "empty nonce present", key: key, claims: withClaim("empty-nonce", "nonce", ""), wantErr: true},
+		{name: "missing jti", key: key, claims: withClaim("no-jti", "jti", nil), wantErr: true},
+		{name: "too old", key: key, claims: withClaim("old", "iat", time.Now().Add(-maxLogoutTokenAge-time.Minute).Unix()), wantErr: true},
+		{name: "expired", key: key, claims: withClaim("expired", "exp", time.Now().Add(-time.Minute).Unix()), wantErr: true},
+		{name: "another audience", key: key, claims: withClaim("audience", "aud", "another-client"), wantErr: true},
+		{name: "another issuer", key: key, claims: withClaim("issuer", "iss", "https://evil.example"), wantErr: true},
+		{name: "signed with another key", key: anotherKey, claims: validClaims("another-key"), wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logoutToken, err := VerifyLogoutToken(context.Background(), createLogoutToken(t, test.key, test.claims))
+			if test.wantErr {
+				if err == nil {
+					t.Error("got no error, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if logoutToken.Sid != test.wantSid || logoutToken.Sub != test.wantSub {
+				t.Errorf("got sid %q and sub %q, want %q and %q", logoutToken.Sid, logoutToken.Sub, test.wantSid, test.wantSub)
+			}
+		})
+	}
+
+	t.Run("replay", func(t *testing.T) {
+		rawLogoutToken := createLogoutToken(t, key, validClaims("replay"))
+
+		// the token can be sent again until the sessions have been destroyed, e.g. when destroying them failed
+		logoutToken, err := VerifyLogoutToken(context.Background(), rawLogoutToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = VerifyLogoutToken(context.Background(), rawLogoutToken)
+		if err != nil {
+			t.Fatalf("got error %v before the token was marked as used, want no error", err)
+		}
+
+		MarkLogoutTokenAsUsed(logoutToken)
+		_, err = VerifyLogoutToken(context.Background(), rawLogoutToken)
+		if err == nil {
+			t.Error("got no error for a used logout token, want an error")
+		}
+	})
+}
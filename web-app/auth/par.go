@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// Sends the request object to the pushed authorization request endpoint of HelseID (PAR, RFC 9126).
+// Returns the url of the authorization endpoint the user must be redirected to,
+// which only contains the client_id and the request_uri returned by HelseID.
+func PushAuthorizationRequest(ctx context.Context, requestObject string) (string, error) {
+	if HelseidMetadata.Pushed_authorization_request_endpoint == "" {
+		return "", errors.New("HelseID does not have a pushed authorization request endpoint")
+	}
+
+	params := url.Values{}
+	params.Set("request", requestObject)
+
+	resp, err := postWithClientAssertion(ctx, HelseidMetadata.Pushed_authorization_request_endpoint, params)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		RequestUri       string `json:"request_uri"`
+		ExpiresIn        int    `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse pushed authorization response: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("pushed authorization request failed with status %v: %v %v", resp.StatusCode, body.Error, body.ErrorDescription)
+	}
+
+	authorizationUrl, err := url.Parse(HelseidMetadata.Authorization_endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("client_id", ClientId)
+	query.Set("request_uri", body.RequestUri)
+	authorizationUrl.RawQuery = query.Encode()
+
+	return authorizationUrl.String(), nil
+}
@@ -0,0 +1,291 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"helseid-webapp/sessionstorage"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"golang.org/x/oauth2"
+)
+
+// The refreshes of a session. The refreshes are serialized since HelseID may rotate the refresh token,
+// so a refresh token can only be used once even if the tokens are for different APIs.
+type sessionRefreshes struct {
+	mutex sync.Mutex
+	// the latest refresh token, used instead of the refresh token in the session if it has been rotated
+	refreshToken string
+	// the latest refreshed token of each API, by resource indicator. A request that read the session before the
+	// refreshed token was saved gets this token instead of refreshing again.
+	tokens  map[string]*oauth2.Token
+	updated time.Time
+}
+
+// how long the refreshes of a session are remembered, the refreshed tokens are saved in the session long before this
+const sessionRefreshesTTL = 10 * time.Minute
+
+// The refreshes are kept in the memory of the process, so concurrent refreshes are only coalesced within one replica
+// of the app. When more than one replica is running, route all requests of a session to the same replica
+// (sticky sessions), otherwise two replicas can use the same refresh token, and HelseID may reject the second refresh.
+var refreshesMutex sync.Mutex
+var refreshesBySession = map[string]*sessionRefreshes{}
+
+// A oauth2.TokenSource that gets the token for the API with the resource indicator from the session,
+// and refreshes it when it has expired. If there is no token for the API a token is requested with the refresh token.
+// A refreshed token is saved in session.Values, the caller must save the session afterwards.
+type sessionTokenSource struct {
+	session  *sessions.Session
+	resource string
+}
+
+// The error from getting the access token for a request, e.g. when the refresh token has expired or been revoked.
+// The request is not sent, and the user must log in again to get new tokens.
+type TokenError struct {
+	Err error
+}
+
+func (e *TokenError) Error() string {
+	return "failed to get an access token: " + e.Err.Error()
+}
+
+func (e *TokenError) Unwrap() error {
+	return e.Err
+}
+
+func (s *sessionTokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.token()
+	if err != nil {
+		return nil, &TokenError{Err: err}
+	}
+	return token, nil
+}
+
+func (s *sessionTokenSource) token() (*oauth2.Token, error) {
+	// the token received at login is for the default API, tokens for the other APIs are in the token cache
+	isDefaultApi := s.resource == Apis[DefaultApi].Resource
+
+	var token *oauth2.Token
+	var ok bool
+	if isDefaultApi {
+		token, ok = sessionstorage.GetToken(s.session)
+		if !ok {
+			return nil, errors.New("no access token found in session")
+		}
+	} else {
+		token, ok = sessionstorage.GetApiToken(s.session, s.resource)
+		if !ok {
+			refreshToken, _ := s.session.Values["refresh_token"].(string)
+			token = &oauth2.Token{RefreshToken: refreshToken}
+		}
+	}
+
+	if token.Valid() {
+		return token, nil
+	}
+
+	if token.RefreshToken == "" {
+		if s.resource == userInfoResource {
+			return nil, errors.New("there is no refresh token in session to request an access token for the userinfo endpoint")
+		}
+		return nil, fmt.Errorf("no valid access token for %v and there is no refresh token in session", s.resource)
+	}
+
+	ctx, err := NewTokenRequestContext(context.Background(), s.session)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshed, err := refreshSessionToken(ctx, s.session.ID, s.resource, token.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if isDefaultApi {
+		sessionstorage.SaveToken(s.session, refreshed)
+	} else {
+		sessionstorage.SaveApiToken(s.session, s.resource, refreshed)
+	}
+
+	return refreshed, nil
+}
+
+// Refreshes the token for the API with the resource indicator of the session with the given id.
+// Concurrent refreshes for the same session are serialized, and a refresh is only done once for each API.
+func refreshSessionToken(ctx context.Context, sessionId, resource, refreshToken string) (*oauth2.Token, error) {
+	refreshes := getSessionRefreshes(sessionId)
+	refreshes.mutex.Lock()
+	defer refreshes.mutex.Unlock()
+
+	if latest, ok := refreshes.tokens[resource]; ok && latest.Valid() {
+		return latest, nil
+	}
+	if refreshes.refreshToken != "" {
+		refreshToken = refreshes.refreshToken
+	}
+
+	token, err := RefreshToken(ctx, refreshToken, resource)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshesMutex.Lock()
+	refreshes.refreshToken = token.RefreshToken
+	refreshes.tokens[resource] = token
+	refreshes.updated = time.Now()
+	refreshesMutex.Unlock()
+
+	return token, nil
+}
+
+func getSessionRefreshes(sessionId string) *sessionRefreshes {
+	refreshesMutex.Lock()
+	defer refreshesMutex.Unlock()
+
+	for id, refreshes := range refreshesBySession {
+		if time.Since(refreshes.updated) > sessionRefreshesTTL {
+			delete(refreshesBySession, id)
+		}
+	}
+
+	refreshes, ok := refreshesBySession[sessionId]
+	if !ok {
+		refreshes = &sessionRefreshes{
+			tokens:  map[string]*oauth2.Token{},
+			updated: time.Now(),
+		}
+		refreshesBySession[sessionId] = refreshes
+	}
+	return refreshes
+}
+
+// Uses the refresh token to get a new access token from HelseID.
+// A new client assertion is created for every refresh.
+// Use NewTokenRequestContext to create ctx, so the request has a DPoP proof when DPoP is enabled.
+// If resource is not empty the access token is issued for the API with the resource indicator (RFC 8707).
+// If HelseID does not rotate the refresh token the returned token keeps the old refresh token.
+func RefreshToken(ctx context.Context, refreshToken, resource string) (*oauth2.Token, error) {
+	params := url.Values{}
+	params.Set("grant_type", "refresh_token")
+	params.Set("refresh_token", refreshToken)
+	if resource != "" {
+		params.Set("resource", resource)
+	}
+
+	token, err := requestToken(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	if token.RefreshToken == "" {
+		token.RefreshToken = refreshToken
+	}
+
+	return token, nil
+}
+
+// Exchanges the authorization code from the callback for tokens, with the code verifier of the login transaction.
+// Use NewTokenRequestContext to create ctx, so the request has a DPoP proof when DPoP is enabled.
+// If resource is not empty the access token is issued for the API with the resource indicator (RFC 8707).
+func ExchangeCode(ctx context.Context, code, codeVerifier, resource string) (*oauth2.Token, error) {
+	params := url.Values{}
+	params.Set("grant_type", "authorization_code")
+	params.Set("code", code)
+	params.Set("code_verifier", codeVerifier)
+	params.Set("redirect_uri", redirectLoginUrl)
+	if resource != "" {
+		params.Set("resource", resource)
+	}
+
+	return requestToken(ctx, params)
+}
+
+// Sends a token request to the token endpoint of HelseID, authenticated with a client assertion.
+func requestToken(ctx context.Context, params url.Values) (*oauth2.Token, error) {
+	resp, err := postWithClientAssertion(ctx, HelseidMetadata.Token_endpoint, params)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		AccessToken      string `json:"access_token"`
+		TokenType        string `json:"token_type"`
+		RefreshToken     string `json:"refresh_token"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Scope            string `json:"scope"`
+		IdToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token response: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token request failed with status %v: %v %v", resp.StatusCode, body.Error, body.ErrorDescription)
+	}
+
+	token := &oauth2.Token{
+		AccessToken:  body.AccessToken,
+		TokenType:    body.TokenType,
+		RefreshToken: body.RefreshToken,
+	}
+	if body.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(body.ExpiresIn) * time.Second)
+	}
+
+	return token.WithExtra(map[string]interface{}{
+		"scope":    body.Scope,
+		"id_token": body.IdToken,
+	}), nil
+}
+
+// Posts the form params to an endpoint of HelseID, with a new client assertion to authenticate the client.
+// If HelseID responds with a use_dpop_nonce error the request is sent again with a new client assertion,
+// since HelseID rejects a client assertion that has already been used. The DPoP proof of the new request
+// contains the nonce, it was saved by the DPoP transport when the first response was received.
+func postWithClientAssertion(ctx context.Context, endpoint string, params url.Values) (*http.Response, error) {
+	// use the client in ctx if there is one, e.g. a client that adds DPoP proofs
+	client, ok := ctx.Value(oauth2.HTTPClient).(*http.Client)
+	if !ok {
+		client = http.DefaultClient
+	}
+
+	for attempt := 1; ; attempt++ {
+		clientAssertionToken, err := GenerateClientAssertionToken()
+		if err != nil {
+			return nil, err
+		}
+		params.Set("client_id", ClientId)
+		params.Set("client_assertion", clientAssertionToken)
+		params.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+
+		req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(params.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if attempt > 1 || !UseDPoP || resp.Header.Get("DPoP-Nonce") == "" {
+			return resp, nil
+		}
+		retry, err := isUseDPoPNonceError(resp)
+		if err != nil || !retry {
+			return resp, err
+		}
+		resp.Body.Close()
+	}
+}
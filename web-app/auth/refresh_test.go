@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/sessions"
+	"golang.org/x/oauth2"
+)
+
+func TestPostWithClientAssertionDPoPNonceRetry(t *testing.T) {
+	tests := []struct {
+		name          string
+		requireNonce  bool
+		wantRequests  int
+		wantAssertion int
+	}{
+		{name: "no nonce required", requireNonce: false, wantRequests: 1, wantAssertion: 1},
+		{name: "nonce required", requireNonce: true, wantRequests: 2, wantAssertion: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assertions := map[string]bool{}
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				assertions[r.PostFormValue("client_assertion")] = true
+				if test.requireNonce && requests == 1 {
+					w.Header().Set("DPoP-Nonce", "server-nonce")
+					w.WriteHeader(http.StatusBadRequest)
+					json.NewEncoder(w).Encode(map[string]string{"error": "use_dpop_nonce"})
+					return
+				}
+				json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "at", "token_type": "DPoP", "expires_in": 60})
+			}))
+			defer server.Close()
+
+			key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client := &http.Client{Transport: &dpopTransport{key: key, base: http.DefaultTransport}}
+			ctx := context.WithValue(context.Background(), oauth2.HTTPClient, client)
+
+			resp, err := postWithClientAssertion(ctx, server.URL+"/token", map[string][]string{"grant_type": {"refresh_token"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("got status %v, want 200", resp.StatusCode)
+			}
+			if requests != test.wantRequests {
+				t.Errorf("got %v requests, want %v", requests, test.wantRequests)
+			}
+			if len(assertions) != test.wantAssertion {
+				t.Errorf("got %v different client assertions, want %v", len(assertions), test.wantAssertion)
+			}
+		})
+	}
+}
+
+func TestSessionTokenSourceError(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   map[interface{}]interface{}
+		resource string
+	}{
+		{name: "no token for the default api", values: map[interface{}]interface{}{}, resource: Apis[DefaultApi].Resource},
+		{name: "no refresh token for another api", values: map[interface{}]interface{}{}, resource: "https://another-api.example"},
+		{name: "no refresh token for the userinfo endpoint", values: map[interface{}]interface{}{}, resource: userInfoResource},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			session := sessions.NewSession(nil, "auth-session")
+			session.Values = test.values
+
+			_, err := (&sessionTokenSource{session: session, resource: test.resource}).Token()
+			var tokenErr *TokenError
+			if !errors.As(err, &tokenErr) {
+				t.Errorf("got error %v, want a TokenError", err)
+			}
+		})
+	}
+}
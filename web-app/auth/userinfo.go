@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/sessions"
+)
+
+// The access tokens for the APIs are issued for the resource indicator of the API, and are rejected by the userinfo
+// endpoint. The userinfo endpoint is called with an access token requested with the refresh token without a
+// resource indicator, which has the openid scope. It is cached in the session with the tokens for the APIs.
+const userInfoResource = ""
+
+// Gets the claims about the user from the userinfo endpoint of HelseID.
+// sub is the subject of the id token, the response is rejected if it is about another user.
+// Requires a refresh token, see requestOfflineAccess. The caller must save the session afterwards.
+func GetUserInfo(session *sessions.Session, sub string) (map[string]interface{}, error) {
+	client, err := newSessionClient(session, userInfoResource)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Get(HelseidMetadata.Userinfo_endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("userinfo request failed with status %v: %v", resp.StatusCode, resp.Header.Get("WWW-Authenticate"))
+	}
+
+	userInfo := map[string]interface{}{}
+	err = json.NewDecoder(resp.Body).Decode(&userInfo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse userinfo response: %v", err)
+	}
+
+	// the userinfo response must be about the user that logged in (OpenID Connect Core 1.0 section 5.3.2)
+	if userInfo["sub"] != sub {
+		return nil, fmt.Errorf("the sub of the userinfo response does not match the sub of the id token")
+	}
+
+	return userInfo, nil
+}
+
+// Adds the claims from the userinfo endpoint to the claims of the id token.
+// The claims of the id token are kept if both contain the same claim.
+func MergeUserInfo(claims, userInfo map[string]interface{}) {
+	for name, value := range userInfo {
+		if _, ok := claims[name]; !ok {
+			claims[name] = value
+		}
+	}
+}
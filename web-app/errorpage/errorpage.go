@@ -0,0 +1,57 @@
+package errorpage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"helseid-webapp/i18n"
+	"helseid-webapp/returnto"
+	"helseid-webapp/templates"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+// An error shown to the user.
+type Error struct {
+	// the http status of the response
+	Status int
+	// selects the message shown to the user, e.g. an OAuth error code like access_denied
+	Code string
+	// logged, but not shown to the user
+	Details string
+	// where the user is sent after logging in again with "try again", if empty the user is not offered to try again
+	ReturnTo string
+}
+
+// Logs the error with a correlation id and renders the error page. The correlation id is shown to the user,
+// so the user can refer to it when contacting support, and the details can be found in the log.
+func Render(w http.ResponseWriter, r *http.Request, e Error) {
+	correlationId := newCorrelationId()
+	log.Printf("error %v (correlation id %v): %v\n", e.Code, correlationId, e.Details)
+
+	// the messages are in the catalogs of i18n, by the error code prefixed with error_
+	language := i18n.Language(r)
+	message, ok := i18n.Text(language)["error_"+e.Code]
+	if !ok {
+		message = i18n.T(language, "error_default")
+	}
+
+	data := map[string]interface{}{
+		"message":       message,
+		"correlationId": correlationId,
+	}
+
+	// "try again" starts a new login with a new login transaction
+	if e.ReturnTo != "" {
+		data["tryAgainUrl"] = "/login?" + url.Values{returnto.QueryParameter: {returnto.ValidOrDefault(e.ReturnTo)}}.Encode()
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	templates.Render(w, r, e.Status, "error", data)
+}
+
+func newCorrelationId() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
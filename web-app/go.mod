@@ -5,6 +5,7 @@ go 1.16
 require (
 	github.com/coreos/go-oidc/v3 v3.0.0
 	github.com/gorilla/mux v1.8.0
+	github.com/gorilla/securecookie v1.1.1
 	github.com/gorilla/sessions v1.2.1
 	github.com/stretchr/testify v1.7.0 // indirect
 	github.com/urfave/negroni v1.0.0
@@ -0,0 +1,70 @@
+package i18n
+
+var en = map[string]string{
+	"languageName": "English",
+
+	// home and organization
+	"homeTitle":           "Home page",
+	"loggedOut":           "You have been logged out of HelseID.",
+	"loginWithHelseid":    "Log in with HelseID",
+	"identityProvider":    "Log in with",
+	"chooseAtHelseid":     "Choose at HelseID",
+	"promptNone":          "Use my HelseID session if I am logged in",
+	"promptLogin":         "Log in again",
+	"promptSelectAccount": "Choose another account",
+	"organizationTitle":   "Choose organization",
+	"chooseOrganization":  "Choose the organization you work for",
+
+	// user
+	"loggedInAs":       "Logged in as",
+	"callApiLink":      "Try to use access token to request resource from api",
+	"sensitiveLink":    "Open a page that requires security level 4 and a recent login",
+	"inspectorLink":    "Inspect claims and tokens",
+	"logoutLocal":      "Log out of this app",
+	"logoutGlobal":     "Log out of HelseID",
+	"sessionExpiresIn": "Your session expires in",
+	"seconds":          "seconds.",
+	"stayLoggedIn":     "Stay logged in",
+	"backToUser":       "Go back to user page",
+	"backToHome":       "Go back to home page",
+	"back":             "Back",
+
+	// callapi
+	"callApiTitle": "Example of using a access token when calling an API",
+	"callApiSent":  "Sent a get request to %v with access token in Authorization header",
+	"response":     "Response:",
+	"status":       "Status",
+	"body":         "Body",
+
+	// sensitive
+	"sensitiveTitle":    "Sensitive page",
+	"sensitiveLoggedIn": "%v logged in with security level %v at %v.",
+
+	// inspector
+	"inspectorTitle":        "Token inspector",
+	"inspectorDevelopers":   "Only for developers, this page is disabled in production mode.",
+	"inspectorLevels":       "Security level: %v, assurance level: %v",
+	"refreshTokenInSession": "Refresh token in session: %v",
+	"claims":                "Claims",
+	"userInfoClaims":        "Claims from the userinfo endpoint",
+	"noUserInfo":            "No userinfo in session",
+	"expires":               "Expires: %v",
+
+	// error page, the messages are selected by error code, e.g. an OAuth error code like access_denied
+	"errorTitle":                       "Login failed",
+	"tryAgain":                         "Try again",
+	"goToHome":                         "Go to the home page",
+	"correlationId":                    "Error id",
+	"error_access_denied":              "The login was cancelled or denied.",
+	"error_login_required":             "You must log in again.",
+	"error_interaction_required":       "HelseID needs more information from you to complete the login.",
+	"error_consent_required":           "You must consent to share your information with the app.",
+	"error_account_selection_required": "You must choose which account to log in with.",
+	"error_temporarily_unavailable":    "HelseID is temporarily unavailable. Please try again in a few minutes.",
+	"error_invalid_state":              "The login has expired or has already been completed. This can happen if you used the back button or waited too long.",
+	"error_login_failed":               "The login could not be completed.",
+	"error_userinfo_failed":            "Your information could not be fetched from HelseID.",
+	"error_requirement_not_met":        "The page requires a stronger login than the one you completed, e.g. with a higher security level.",
+	"error_organization_mismatch":      "You could not be logged in on behalf of the organization you chose.",
+	"error_default":                    "Something went wrong.",
+}
@@ -0,0 +1,85 @@
+package i18n
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// settings
+// The language used if the user has not chosen a language, and the browser does not ask for a language the app supports.
+const DefaultLanguage = "en"
+
+// The cookie with the language the user has chosen with the language toggle.
+const CookieName = "language"
+
+// The text of the pages by key, for each language the app supports.
+var catalogs = map[string]map[string]string{
+	"nb": nb,
+	"en": en,
+}
+
+// The languages the app supports, in the order they are shown in the language toggle.
+var Languages = []string{"nb", "en"}
+
+// Returns the language of the user: the language chosen with the language toggle, or the first language
+// in the Accept-Language header of the browser that the app supports, or DefaultLanguage.
+func Language(r *http.Request) string {
+	if cookie, err := r.Cookie(CookieName); err == nil && isSupported(cookie.Value) {
+		return cookie.Value
+	}
+
+	for _, language := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag := strings.ToLower(strings.TrimSpace(strings.SplitN(language, ";", 2)[0]))
+		switch primary := strings.SplitN(tag, "-", 2)[0]; primary {
+		// Norwegian Bokmål is used for all the Norwegian language tags
+		case "nb", "no", "nn":
+			return "nb"
+		default:
+			if isSupported(primary) {
+				return primary
+			}
+		}
+	}
+
+	return DefaultLanguage
+}
+
+// Saves the language chosen by the user in a cookie, returns false if the app does not support the language.
+func SetLanguage(w http.ResponseWriter, language string) bool {
+	if !isSupported(language) {
+		return false
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     CookieName,
+		Value:    language,
+		Path:     "/",
+		MaxAge:   int((365 * 24 * time.Hour).Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return true
+}
+
+// Returns the text of the pages in the language by key.
+func Text(language string) map[string]string {
+	if catalog, ok := catalogs[language]; ok {
+		return catalog
+	}
+	return catalogs[DefaultLanguage]
+}
+
+// Returns the text with the key in the language, or the text in DefaultLanguage if the key is missing in the language.
+func T(language, key string) string {
+	if text, ok := Text(language)[key]; ok {
+		return text
+	}
+	return catalogs[DefaultLanguage][key]
+}
+
+func isSupported(language string) bool {
+	_, ok := catalogs[language]
+	return ok
+}
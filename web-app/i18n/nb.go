@@ -0,0 +1,70 @@
+package i18n
+
+var nb = map[string]string{
+	"languageName": "Norsk",
+
+	// home and organization
+	"homeTitle":           "Forside",
+	"loggedOut":           "Du er logget ut av HelseID.",
+	"loginWithHelseid":    "Logg inn med HelseID",
+	"identityProvider":    "Logg inn med",
+	"chooseAtHelseid":     "Velg hos HelseID",
+	"promptNone":          "Bruk HelseID-økten min hvis jeg er innlogget",
+	"promptLogin":         "Logg inn på nytt",
+	"promptSelectAccount": "Velg en annen konto",
+	"organizationTitle":   "Velg virksomhet",
+	"chooseOrganization":  "Velg virksomheten du jobber for",
+
+	// user
+	"loggedInAs":       "Logget inn som",
+	"callApiLink":      "Prøv å bruke access token til å hente en ressurs fra API-et",
+	"sensitiveLink":    "Åpne en side som krever sikkerhetsnivå 4 og en nylig innlogging",
+	"inspectorLink":    "Se claims og tokens",
+	"logoutLocal":      "Logg ut av denne appen",
+	"logoutGlobal":     "Logg ut av HelseID",
+	"sessionExpiresIn": "Økten din utløper om",
+	"seconds":          "sekunder.",
+	"stayLoggedIn":     "Forbli innlogget",
+	"backToUser":       "Gå tilbake til brukersiden",
+	"backToHome":       "Gå tilbake til forsiden",
+	"back":             "Tilbake",
+
+	// callapi
+	"callApiTitle": "Eksempel på bruk av access token ved kall til et API",
+	"callApiSent":  "Sendte en GET-forespørsel til %v med access token i Authorization-headeren",
+	"response":     "Svar:",
+	"status":       "Status",
+	"body":         "Innhold",
+
+	// sensitive
+	"sensitiveTitle":    "Sensitiv side",
+	"sensitiveLoggedIn": "%v logget inn med sikkerhetsnivå %v, tidspunkt %v.",
+
+	// inspector
+	"inspectorTitle":        "Token-inspektør",
+	"inspectorDevelopers":   "Kun for utviklere, siden er skrudd av i produksjon.",
+	"inspectorLevels":       "Sikkerhetsnivå: %v, tillitsnivå: %v",
+	"refreshTokenInSession": "Refresh token i økten: %v",
+	"claims":                "Claims",
+	"userInfoClaims":        "Claims fra userinfo-endepunktet",
+	"noUserInfo":            "Ingen userinfo i økten",
+	"expires":               "Utløper: %v",
+
+	// error page, the messages are selected by error code, e.g. an OAuth error code like access_denied
+	"errorTitle":                       "Innloggingen feilet",
+	"tryAgain":                         "Prøv igjen",
+	"goToHome":                         "Gå til forsiden",
+	"correlationId":                    "Feil-id",
+	"error_access_denied":              "Innloggingen ble avbrutt eller avvist.",
+	"error_login_required":             "Du må logge inn på nytt.",
+	"error_interaction_required":       "HelseID trenger mer informasjon fra deg for å fullføre innloggingen.",
+	"error_consent_required":           "Du må samtykke til å dele informasjonen din med appen.",
+	"error_account_selection_required": "Du må velge hvilken konto du vil logge inn med.",
+	"error_temporarily_unavailable":    "HelseID er midlertidig utilgjengelig. Prøv igjen om noen minutter.",
+	"error_invalid_state":              "Innloggingen er utløpt eller allerede fullført. Dette kan skje hvis du brukte tilbakeknappen eller ventet for lenge.",
+	"error_login_failed":               "Innloggingen kunne ikke fullføres.",
+	"error_userinfo_failed":            "Informasjonen om deg kunne ikke hentes fra HelseID.",
+	"error_requirement_not_met":        "Siden krever en sterkere innlogging enn den du fullførte, for eksempel med et høyere sikkerhetsnivå.",
+	"error_organization_mismatch":      "Du kunne ikke logges inn på vegne av virksomheten du valgte.",
+	"error_default":                    "Noe gikk galt.",
+}
@@ -0,0 +1,77 @@
+package idp
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// settings
+
+// The identity providers the user can choose between on the home page. The names must be the names
+// of the identity providers at HelseID, check which identity providers are available in your environment.
+var IdentityProviders = []IdentityProvider{
+	{Name: "bankid", DisplayName: "BankID"},
+	{Name: "buypass", DisplayName: "Buypass"},
+	{Name: "commfides", DisplayName: "Commfides"},
+	{Name: "idporten", DisplayName: "ID-porten"},
+	{Name: "testidp-oidc", DisplayName: "Test IdP"},
+}
+
+// The cookie with the identity provider the user chose the last time, so it is preselected on the home page.
+const CookieName = "last-idp"
+
+// An identity provider at HelseID, e.g. BankID.
+type IdentityProvider struct {
+	Name        string
+	DisplayName string
+}
+
+var ErrUnknownIdentityProvider = errors.New("unknown identity provider")
+
+// Finds the identity provider with the name among IdentityProviders.
+func Find(name string) (IdentityProvider, error) {
+	for _, identityProvider := range IdentityProviders {
+		if identityProvider.Name == name {
+			return identityProvider, nil
+		}
+	}
+
+	return IdentityProvider{}, ErrUnknownIdentityProvider
+}
+
+// The acr value that asks HelseID to send the user directly to the identity provider,
+// instead of letting the user choose the identity provider at HelseID.
+func AcrValue(name string) string {
+	return "idp:" + name
+}
+
+// Returns the name of the identity provider the user chose the last time, or "" if the user has not chosen one.
+func Remembered(r *http.Request) string {
+	cookie, err := r.Cookie(CookieName)
+	if err != nil {
+		return ""
+	}
+
+	if _, err := Find(cookie.Value); err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// Remembers the identity provider the user chose, or forgets it if name is "".
+func Remember(w http.ResponseWriter, name string) {
+	cookie := &http.Cookie{
+		Name:     CookieName,
+		Value:    name,
+		Path:     "/",
+		MaxAge:   int((365 * 24 * time.Hour).Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if name == "" {
+		cookie.MaxAge = -1
+	}
+
+	http.SetCookie(w, cookie)
+}
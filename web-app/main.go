@@ -4,10 +4,19 @@ import (
 	"helseid-webapp/auth"
 	"helseid-webapp/server"
 	"helseid-webapp/sessionstorage"
+	"helseid-webapp/templates"
+	"log"
 )
 
 func main() {
-	sessionstorage.Init()
+	err := sessionstorage.Init()
+	if err != nil {
+		log.Fatalf("Failed to initialize the session store\n    Error: %s\n", err.Error())
+	}
+	err = templates.Init()
+	if err != nil {
+		log.Fatalf("Failed to parse the templates\n    Error: %s\n", err.Error())
+	}
 	auth.RefreshHelseidMetadata()
 	server.StartServer()
 }
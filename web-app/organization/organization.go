@@ -0,0 +1,87 @@
+package organization
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// settings
+
+// Let the user choose the organization to log in on behalf of at /organization before login.
+// The client must be a multi-tenant client at HelseID for this to work.
+const SelectBeforeLogin = false
+
+// The organizations the user can choose between. Replace this with your own organizations,
+// or replace Lookup to get them from somewhere else.
+var Organizations = []Organization{
+	{Name: "Norsk helsenett SF", OrgNrParent: "994598759", OrgNrChild: "994598759"},
+	{Name: "Testlegekontoret", OrgNrParent: "994598759", OrgNrChild: "999977775"},
+}
+
+// Returns the organizations the user can choose between at /organization.
+var Lookup = func(r *http.Request) ([]Organization, error) {
+	return Organizations, nil
+}
+
+// An organization identified by the organization number of the legal entity (parent)
+// and the organization number of the sub-unit (child) in the Central Coordinating Register for Legal Entities.
+type Organization struct {
+	Name        string
+	OrgNrParent string
+	OrgNrChild  string
+}
+
+var ErrUnknownOrganization = errors.New("unknown organization")
+
+// Finds the organization with the child organization number among the organizations returned by Lookup.
+func Find(r *http.Request, orgNrChild string) (Organization, error) {
+	organizations, err := Lookup(r)
+	if err != nil {
+		return Organization{}, err
+	}
+
+	for _, organization := range organizations {
+		if organization.OrgNrChild == orgNrChild {
+			return organization, nil
+		}
+	}
+
+	return Organization{}, ErrUnknownOrganization
+}
+
+func (o Organization) IsZero() bool {
+	return o.OrgNrParent == "" && o.OrgNrChild == ""
+}
+
+// The authorization_details of the authorization request that asks HelseID to log the user in on behalf of the organization.
+func (o Organization) AuthorizationDetails() []interface{} {
+	return []interface{}{
+		map[string]interface{}{
+			"type": "helseid_authorization",
+			"practitioner_role": map[string]interface{}{
+				"organization": map[string]interface{}{
+					"identifier": map[string]interface{}{
+						// the OID of the Norwegian organization numbers
+						"system": "urn:oid:1.0.6523",
+						"type":   "ENH",
+						"value":  fmt.Sprintf("NO:ORGNR:%v:%v", o.OrgNrParent, o.OrgNrChild),
+					},
+				},
+			},
+		},
+	}
+}
+
+// Checks that the organization is in the claims of one of the tokens returned by HelseID.
+func (o Organization) Verify(tokenClaims ...map[string]interface{}) error {
+	for _, claims := range tokenClaims {
+		orgNrParent, _ := claims["helseid://claims/client/claims/orgnr_parent"].(string)
+		orgNrChild, _ := claims["helseid://claims/client/claims/orgnr_child"].(string)
+		if orgNrParent == o.OrgNrParent && orgNrChild == o.OrgNrChild {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("the tokens are not issued for the organization %v:%v", o.OrgNrParent, o.OrgNrChild)
+}
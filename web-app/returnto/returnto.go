@@ -0,0 +1,100 @@
+package returnto
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// settings
+
+// The paths the user can be sent back to after login. A path ending with / allows all paths below it.
+// Only paths in the app itself are allowed, so the return-to url can not be used to redirect to another site.
+var AllowedPaths = []string{
+	"/user",
+	"/callapi",
+	"/sensitive",
+	"/dev/tokens",
+}
+
+// where the user is sent after login if there is no valid return-to url
+const DefaultUrl = "/user"
+
+// The name of the query parameter with the return-to url at / and /login.
+const QueryParameter = "return_to"
+
+// Returns the url the user requested if it can be returned to after login.
+// Only GET requests are returned to, the body of other requests would be lost anyway.
+func FromRequest(r *http.Request) (string, bool) {
+	if r.Method != http.MethodGet {
+		return "", false
+	}
+
+	return Validate(r.URL.RequestURI())
+}
+
+// Checks that returnTo is a relative url with one of the allowed paths,
+// and returns it without fragment. Returns false if it is not allowed.
+func Validate(returnTo string) (string, bool) {
+	u, ok := parseLocal(returnTo)
+	if !ok || !isAllowedPath(u.Path) {
+		return "", false
+	}
+	return u.RequestURI(), true
+}
+
+// Checks that returnTo is a relative url to any page of the app, e.g. the page the language toggle was used on,
+// and returns it without fragment. Returns false if it can lead to another site.
+func ValidateLocal(returnTo string) (string, bool) {
+	u, ok := parseLocal(returnTo)
+	if !ok {
+		return "", false
+	}
+	return u.RequestURI(), true
+}
+
+// Parses returnTo if it is a relative url in the app without dot segments, and removes the fragment.
+func parseLocal(returnTo string) (*url.URL, bool) {
+	// reject urls the browser may read as another host, e.g. //evil.example or /\evil.example
+	if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") || strings.Contains(returnTo, "\\") {
+		return nil, false
+	}
+
+	u, err := url.Parse(returnTo)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.User != nil || u.Opaque != "" {
+		return nil, false
+	}
+
+	// reject paths with dot segments, e.g. /user/../admin, a trailing slash is kept for the paths below an allowed path
+	cleaned := path.Clean(u.Path)
+	if strings.HasSuffix(u.Path, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	if cleaned != u.Path {
+		return nil, false
+	}
+
+	u.Fragment = ""
+	return u, true
+}
+
+// Returns returnTo if it is valid, or DefaultUrl.
+func ValidOrDefault(returnTo string) string {
+	if valid, ok := Validate(returnTo); ok {
+		return valid
+	}
+	return DefaultUrl
+}
+
+func isAllowedPath(requestPath string) bool {
+	for _, allowed := range AllowedPaths {
+		if requestPath == allowed {
+			return true
+		}
+		if strings.HasSuffix(allowed, "/") && strings.HasPrefix(requestPath, allowed) {
+			return true
+		}
+	}
+	return false
+}
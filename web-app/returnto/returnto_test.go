@@ -0,0 +1,143 @@
+package returnto
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		returnTo string
+		want     string
+		wantOk   bool
+	}{
+		{name: "allowed path", returnTo: "/user", want: "/user", wantOk: true},
+		{name: "with query", returnTo: "/callapi?api=notes&x=1", want: "/callapi?api=notes&x=1", wantOk: true},
+		{name: "fragment is removed", returnTo: "/sensitive#top", want: "/sensitive", wantOk: true},
+		{name: "escaped query", returnTo: "/user?next=%2F%2Fevil.example", want: "/user?next=%2F%2Fevil.example", wantOk: true},
+		{name: "empty", returnTo: ""},
+		{name: "path not allowed", returnTo: "/admin"},
+		{name: "below an allowed path without trailing slash", returnTo: "/user/settings"},
+		{name: "prefix of an allowed path", returnTo: "/users"},
+		{name: "relative path", returnTo: "user"},
+		{name: "absolute url", returnTo: "https://evil.example/user"},
+		{name: "scheme relative url", returnTo: "//evil.example/user"},
+		{name: "scheme relative url with three slashes", returnTo: "///evil.example/user"},
+		{name: "backslash after slash", returnTo: `/\evil.example/user`},
+		{name: "backslashes", returnTo: `\\evil.example/user`},
+		{name: "backslash in path", returnTo: `/user\..\admin`},
+		{name: "javascript url", returnTo: "javascript:alert(1)"},
+		{name: "dot dot segment", returnTo: "/user/../admin"},
+		{name: "dot dot segment to allowed path", returnTo: "/admin/../user"},
+		{name: "dot segment", returnTo: "/./user"},
+		{name: "trailing dot segment", returnTo: "/user/."},
+		{name: "double slash in path", returnTo: "/user//"},
+		{name: "escaped dot dot segment", returnTo: "/admin/%2e%2e/user"},
+		{name: "escaped slash", returnTo: "/%2F/evil.example"},
+		{name: "userinfo", returnTo: "/@evil.example"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := Validate(test.returnTo)
+			if ok != test.wantOk || got != test.want {
+				t.Errorf("Validate(%q) = %q, %v, want %q, %v", test.returnTo, got, ok, test.want, test.wantOk)
+			}
+		})
+	}
+}
+
+func TestValidateWithPrefix(t *testing.T) {
+	defer func(allowed []string) { AllowedPaths = allowed }(AllowedPaths)
+	AllowedPaths = []string{"/notes/"}
+
+	tests := []struct {
+		returnTo string
+		wantOk   bool
+	}{
+		{returnTo: "/notes/", wantOk: true},
+		{returnTo: "/notes/1", wantOk: true},
+		{returnTo: "/notes"},
+		{returnTo: "/notes/../user"},
+		{returnTo: "/notesx/1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.returnTo, func(t *testing.T) {
+			_, ok := Validate(test.returnTo)
+			if ok != test.wantOk {
+				t.Errorf("Validate(%q) = %v, want %v", test.returnTo, ok, test.wantOk)
+			}
+		})
+	}
+}
+
+func TestValidateLocal(t *testing.T) {
+	tests := []struct {
+		name     string
+		returnTo string
+		want     string
+		wantOk   bool
+	}{
+		{name: "home page with return to", returnTo: "/?return_to=%2Fsensitive", want: "/?return_to=%2Fsensitive", wantOk: true},
+		{name: "page that is not returned to after login", returnTo: "/organization?return_to=%2Fuser", want: "/organization?return_to=%2Fuser", wantOk: true},
+		{name: "allowed path", returnTo: "/user", want: "/user", wantOk: true},
+		{name: "fragment is removed", returnTo: "/#top", want: "/", wantOk: true},
+		{name: "empty", returnTo: ""},
+		{name: "absolute url", returnTo: "https://evil.example/"},
+		{name: "scheme relative url", returnTo: "//evil.example/"},
+		{name: "backslash after slash", returnTo: `/\evil.example/`},
+		{name: "dot dot segment", returnTo: "/user/../admin"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := ValidateLocal(test.returnTo)
+			if ok != test.wantOk || got != test.want {
+				t.Errorf("ValidateLocal(%q) = %q, %v, want %q, %v", test.returnTo, got, ok, test.want, test.wantOk)
+			}
+		})
+	}
+}
+
+func TestFromRequest(t *testing.T) {
+	tests := []struct {
+		method string
+		target string
+		want   string
+		wantOk bool
+	}{
+		{method: "GET", target: "/callapi?api=notes", want: "/callapi?api=notes", wantOk: true},
+		{method: "POST", target: "/callapi"},
+		{method: "GET", target: "/logout"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.method+" "+test.target, func(t *testing.T) {
+			got, ok := FromRequest(httptest.NewRequest(test.method, test.target, nil))
+			if ok != test.wantOk || got != test.want {
+				t.Errorf("got %q, %v, want %q, %v", got, ok, test.want, test.wantOk)
+			}
+		})
+	}
+}
+
+func TestValidOrDefault(t *testing.T) {
+	tests := []struct {
+		returnTo string
+		want     string
+	}{
+		{returnTo: "/sensitive", want: "/sensitive"},
+		{returnTo: "//evil.example", want: DefaultUrl},
+		{returnTo: "", want: DefaultUrl},
+	}
+
+	for _, test := range tests {
+		t.Run(test.returnTo, func(t *testing.T) {
+			if got := ValidOrDefault(test.returnTo); got != test.want {
+				t.Errorf("ValidOrDefault(%q) = %q, want %q", test.returnTo, got, test.want)
+			}
+		})
+	}
+}
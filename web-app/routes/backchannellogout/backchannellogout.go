@@ -0,0 +1,48 @@
+package backchannellogout
+
+import (
+	"encoding/json"
+	"helseid-webapp/auth"
+	"helseid-webapp/sessionstorage"
+	"log"
+	"net/http"
+)
+
+// Called by HelseID (not the browser) when the user logs out of HelseID, e.g. from another application.
+// Destroys the sessions of the HelseID session (sid) in the logout token,
+// or all sessions of the user (sub) if the token does not contain a sid.
+func BackchannelLogoutHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	logoutToken, err := auth.VerifyLogoutToken(r.Context(), r.PostFormValue("logout_token"))
+	if err != nil {
+		log.Printf("invalid logout token: %v\n", err)
+		writeError(w, err.Error())
+		return
+	}
+
+	if logoutToken.Sid != "" {
+		err = sessionstorage.DestroyBySid(logoutToken.Sid)
+	} else {
+		err = sessionstorage.DestroyBySub(logoutToken.Sub)
+	}
+	if err != nil {
+		log.Printf("failed to destroy session: %v\n", err)
+		http.Error(w, "failed to destroy session", http.StatusInternalServerError)
+		return
+	}
+
+	// the token is only recorded as used when the sessions are destroyed, so HelseID can retry after an error
+	auth.MarkLogoutTokenAsUsed(logoutToken)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func writeError(w http.ResponseWriter, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":             "invalid_request",
+		"error_description": description,
+	})
+}
@@ -0,0 +1,109 @@
+package bff
+
+import (
+	"errors"
+	"helseid-webapp/auth"
+	"helseid-webapp/sessionstorage"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// settings
+
+// The header the front end must add to every request to the BFF, with the value 1. A cross-site form or link
+// can not add a custom header, and a cross-site fetch with it must pass a CORS preflight, which protects against CSRF.
+const csrfHeader = "X-CSRF"
+
+// Backend for frontend: forwards requests from the JavaScript of the front end to an API, with the access token
+// of the session. The tokens stay on the server and never reach JavaScript, the front end is only authenticated
+// with the session cookie. Responses are streamed back to the front end.
+func BffHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get(csrfHeader) != "1" {
+		http.Error(w, "Missing "+csrfHeader+" header", http.StatusForbidden)
+		return
+	}
+
+	// the front end can call the APIs in auth.Apis, a request to /bff/{api id}/path is sent to the url of the API followed by /path
+	apiName := mux.Vars(r)["api"]
+	api, ok := auth.Apis[apiName]
+	if !ok {
+		http.Error(w, "Unknown api "+apiName, http.StatusNotFound)
+		return
+	}
+	upstreamUrl, err := url.Parse(api.Url)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	session, err := sessionstorage.Store.Get(r, "auth-session")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, ok := sessionstorage.GetToken(session); !ok {
+		http.Error(w, "Not logged in", http.StatusUnauthorized)
+		return
+	}
+
+	// requests from the front end are activity of the user
+	sessionstorage.Touch(session)
+
+	// the client adds an access token for the API, and a DPoP proof when DPoP is enabled,
+	// and gets a new access token if there is none for the API or it has expired
+	client, err := auth.NewClient(session, apiName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = upstreamUrl.Scheme
+			req.URL.Host = upstreamUrl.Host
+			req.URL.Path = strings.TrimSuffix(upstreamUrl.Path, "/") + strings.TrimPrefix(req.URL.Path, "/bff/"+apiName)
+			req.URL.RawPath = ""
+			req.Host = upstreamUrl.Host
+
+			// the session cookie and the CSRF header are only for the BFF, and the transport adds the access token
+			req.Header.Del("Cookie")
+			req.Header.Del(csrfHeader)
+			req.Header.Del("Authorization")
+			req.Header.Del("DPoP")
+		},
+		Transport: client.Transport,
+		// stream the response, e.g. server-sent events, instead of buffering it
+		FlushInterval: -1,
+		ModifyResponse: func(resp *http.Response) error {
+			// the api must not set cookies for the web app
+			resp.Header.Del("Set-Cookie")
+
+			// save the refreshed token if the access token was refreshed, before the response is written
+			return session.Save(r, w)
+		},
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			log.Printf("bff request to %v failed: %v\n", apiName, err)
+
+			// a refresh token may have been used even if the request failed, save the refreshed token
+			saveErr := session.Save(r, w)
+			if saveErr != nil {
+				log.Printf("failed to save session: %v\n", saveErr)
+			}
+
+			// the front end must send the user to login when there is no access token, and only retry when the api failed
+			var tokenErr *auth.TokenError
+			if errors.As(err, &tokenErr) {
+				http.Error(w, "Failed to get an access token, log in again", http.StatusUnauthorized)
+				return
+			}
+			http.Error(w, "Request to the api failed", http.StatusBadGateway)
+		},
+	}
+
+	proxy.ServeHTTP(w, r)
+}
@@ -4,13 +4,11 @@ import (
 	"fmt"
 	"helseid-webapp/auth"
 	"helseid-webapp/sessionstorage"
+	"helseid-webapp/templates"
 	"io/ioutil"
 	"net/http"
-	"text/template"
 )
 
-var responseTemplate, _ = template.ParseFiles("routes/callapi/callapi.html")
-
 func CallApiHandler(w http.ResponseWriter, r *http.Request) {
 
 	// retrieve access token from session
@@ -19,22 +17,34 @@ func CallApiHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	accessToken, ok := session.Values["access_token"].(string)
-	if !ok {
+	if _, ok := sessionstorage.GetToken(session); !ok {
 		http.Error(w, "No access token found in session", http.StatusForbidden)
 		return
 	}
 
 	// make a request to the api with a client that automatically adds
-	// Authorization header with content: Bearer (the encoded access token)
-	resourceEndpoint := "http://localhost:3123/foo"
-	client := auth.NewClient(accessToken)
+	// Authorization header with content: DPoP (the encoded access token) and a DPoP proof
+	// and refreshes the access token if it has expired
+	resourceEndpoint := auth.Apis[auth.DefaultApi].Url + "/foo"
+	client, err := auth.NewClient(session, auth.DefaultApi)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	resp, err := client.Get(resourceEndpoint)
 	if err != nil {
 		http.Error(w, "Making a request to the api failed, error: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// save the refreshed token if the access token was refreshed
+	err = session.Save(r, w)
+	if err != nil {
+		resp.Body.Close()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	body, err := ioutil.ReadAll(resp.Body)
 	resp.Body.Close()
 	if err != nil {
@@ -42,11 +52,11 @@ func CallApiHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data := map[string]string{
+	data := map[string]interface{}{
 		"status":           fmt.Sprint(resp.StatusCode, " ", http.StatusText(resp.StatusCode)),
 		"body":             string(body),
 		"resourceEndpoint": resourceEndpoint,
 	}
 
-	responseTemplate.Execute(w, data)
+	templates.Render(w, r, http.StatusOK, "callapi", data)
 }
@@ -2,13 +2,16 @@ package callback
 
 import (
 	"context"
+	"fmt"
 	"helseid-webapp/auth"
+	"helseid-webapp/errorpage"
+	"helseid-webapp/returnto"
 	"helseid-webapp/sessionstorage"
 	"log"
 	"net/http"
 
 	"github.com/coreos/go-oidc/v3/oidc"
-	"golang.org/x/oauth2"
+	"github.com/gorilla/sessions"
 )
 
 func CallbackHandler(w http.ResponseWriter, r *http.Request) {
@@ -16,48 +19,55 @@ func CallbackHandler(w http.ResponseWriter, r *http.Request) {
 	// get the session to retrive values stored at login
 	session, err := sessionstorage.Store.Get(r, "auth-session")
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		renderError(w, r, http.StatusInternalServerError, "default", err.Error(), returnto.DefaultUrl)
 		return
 	}
 
-	// check that state matches state generated when initiating login
-	if r.URL.Query().Get("state") != session.Values["state"] {
-		http.Error(w, "Invalid state parameter", http.StatusBadRequest)
+	// HelseID redirects back with an error instead of a code when the login failed, e.g. when the user cancelled the login
+	if errorCode := r.URL.Query().Get("error"); errorCode != "" {
+		handleErrorResponse(w, r, session, errorCode)
 		return
 	}
 
-	// get code verifier from session and create a AuthCodeOption for the token exchange request
-	codeVerifier := session.Values["code-verifier"].(string)
-	codeVerifierOpt := oauth2.SetAuthURLParam("code_verifier", codeVerifier)
-
-	// generate a jwt to authenticate client with client assertion
-	clientAssertionToken, err := auth.GenerateClientAssertionToken()
+	// get the login transaction with the state generated when initiating login,
+	// it is removed from the session so the state can only be used once
+	transaction, err := sessionstorage.ConsumeLoginTransaction(session, r.URL.Query().Get("state"))
+	if err != nil {
+		renderError(w, r, http.StatusBadRequest, "invalid_state", "invalid state parameter: "+err.Error(), returnto.DefaultUrl)
+		return
+	}
+	err = session.Save(r, w)
 	if err != nil {
-		http.Error(w, "Failed to create client assertion token", http.StatusInternalServerError)
+		renderError(w, r, http.StatusInternalServerError, "default", err.Error(), transaction.ReturnTo)
 		return
 	}
-	clientAssertionTokenOpt := oauth2.SetAuthURLParam("client_assertion", clientAssertionToken)
-	clientAssertionTypeOpt := oauth2.SetAuthURLParam("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
 
 	// create new authenticator
 	authenticator, err := auth.NewAuthenticator()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		renderError(w, r, http.StatusInternalServerError, "login_failed", err.Error(), transaction.ReturnTo)
+		return
+	}
+
+	// create a context for the token request that adds a DPoP proof when DPoP is enabled
+	tokenRequestCtx, err := auth.NewTokenRequestContext(context.TODO(), session)
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, "login_failed", err.Error(), transaction.ReturnTo)
 		return
 	}
 
-	// exchange authorization code for access token
-	token, err := authenticator.Config.Exchange(context.TODO(), r.URL.Query().Get("code"), codeVerifierOpt, clientAssertionTokenOpt, clientAssertionTypeOpt)
+	// exchange authorization code for access token, authenticated with a new client assertion for every attempt.
+	// The access token is issued for the default API, tokens for the other APIs are requested with the refresh token
+	token, err := auth.ExchangeCode(tokenRequestCtx, r.URL.Query().Get("code"), transaction.CodeVerifier, auth.Apis[auth.DefaultApi].Resource)
 	if err != nil {
-		log.Printf("no token found: %v\n", err)
-		w.WriteHeader(http.StatusUnauthorized)
+		renderError(w, r, http.StatusBadGateway, "login_failed", "token request failed: "+err.Error(), transaction.ReturnTo)
 		return
 	}
 
 	// extract ID token string from auth token
 	rawIDToken, ok := token.Extra("id_token").(string)
 	if !ok {
-		http.Error(w, "No id_token field in oauth2 token.", http.StatusInternalServerError)
+		renderError(w, r, http.StatusBadGateway, "login_failed", "no id_token field in oauth2 token", transaction.ReturnTo)
 		return
 	}
 
@@ -67,35 +77,123 @@ func CallbackHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	idToken, err := authenticator.Provider.Verifier(oidcConfig).Verify(context.TODO(), rawIDToken)
 	if err != nil {
-		http.Error(w, "Failed to verify ID Token"+err.Error(), http.StatusInternalServerError)
+		renderError(w, r, http.StatusBadGateway, "login_failed", "failed to verify id token: "+err.Error(), transaction.ReturnTo)
 		return
 	}
 
-	// check that the nonce in idToken matches the nonce of the session
-	if idToken.Nonce != session.Values["nonce"] {
-		http.Error(w, "Invalid nonce", http.StatusBadRequest)
+	// check that the nonce in idToken matches the nonce of the login transaction
+	if idToken.Nonce != transaction.Nonce {
+		renderError(w, r, http.StatusBadRequest, "login_failed", "invalid nonce", transaction.ReturnTo)
 		return
 	}
 
 	// getting the claims from the id token
 	var claims map[string]interface{}
 	if err := idToken.Claims(&claims); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		renderError(w, r, http.StatusBadGateway, "login_failed", err.Error(), transaction.ReturnTo)
 		return
 	}
 
-	// save ID token, access token and claims
+	// check that the user authenticated as required by the page that started the login, e.g. with a higher security level
+	err = transaction.Requirement.Check(claims)
+	if err != nil {
+		renderError(w, r, http.StatusForbidden, "requirement_not_met", err.Error(), transaction.ReturnTo)
+		return
+	}
+
+	// check that the tokens are issued for the organization the user chose before login
+	if !transaction.Organization.IsZero() {
+		accessTokenClaims, _ := auth.AccessTokenClaims(token.AccessToken)
+		err = transaction.Organization.Verify(claims, accessTokenClaims)
+		if err != nil {
+			renderError(w, r, http.StatusForbidden, "organization_mismatch", err.Error(), transaction.ReturnTo)
+			return
+		}
+	}
+	session.Values["organization"] = transaction.Organization
+
+	// the tokens for the other APIs and the userinfo of an earlier login may be for another security level or organization
+	delete(session.Values, "api_tokens")
+	delete(session.Values, "userinfo")
+
+	// save ID token, the tokens used to call APIs (access token, refresh token, expiry and scopes) and claims
 	session.Values["id_token"] = rawIDToken
-	session.Values["access_token"] = token.AccessToken
+	sessionstorage.SaveToken(session, token)
+
+	// add the claims from the userinfo endpoint, the login fails if the claims can not be fetched
+	if auth.FetchUserInfo {
+		userInfo, err := auth.GetUserInfo(session, idToken.Subject)
+		if err != nil {
+			renderError(w, r, http.StatusBadGateway, "userinfo_failed", "failed to get userinfo: "+err.Error(), transaction.ReturnTo)
+			return
+		}
+		session.Values["userinfo"] = userInfo
+		auth.MergeUserInfo(claims, userInfo)
+	}
 	session.Values["claims"] = claims
 
-	// save content of session
-	err = session.Save(r, w)
+	// save the HelseID session id (sid) used at front-channel logout,
+	// and the session state used to check the HelseID session with the check_session_iframe
+	sid, _ := claims["sid"].(string)
+	session.Values["sid"] = sid
+	session.Values["session_state"] = r.URL.Query().Get("session_state")
+
+	// start the absolute and idle timeouts of the session
+	sessionstorage.StartLifetime(session)
+
+	// a new CSRF token is created for the new login
+	delete(session.Values, "csrf_token")
+
+	// save content of session with a new session id, to prevent session fixation
+	err = sessionstorage.Regenerate(r, w, session)
+	if err != nil {
+		renderError(w, r, http.StatusInternalServerError, "default", err.Error(), transaction.ReturnTo)
+		return
+	}
+
+	// record the HelseID session and user of the session, so it can be destroyed at back-channel logout
+	err = sessionstorage.IndexSession(session.ID, sid, idToken.Subject)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		renderError(w, r, http.StatusInternalServerError, "default", "failed to index session: "+err.Error(), transaction.ReturnTo)
 		return
 	}
 
-	// redirect to user page
-	http.Redirect(w, r, "/user", http.StatusSeeOther)
+	// redirect to the url the user requested before login, it is validated again in case the session store is compromised
+	http.Redirect(w, r, returnto.ValidOrDefault(transaction.ReturnTo), http.StatusSeeOther)
+}
+
+// Shows an error page for an error response from HelseID (RFC 6749 section 4.1.2.1), with a message for the error code.
+// The login transaction of the state is removed, so the state can not be used again.
+func handleErrorResponse(w http.ResponseWriter, r *http.Request, session *sessions.Session, errorCode string) {
+	query := r.URL.Query()
+
+	returnTo := returnto.DefaultUrl
+	transaction, err := sessionstorage.ConsumeLoginTransaction(session, query.Get("state"))
+	if err == nil {
+		returnTo = transaction.ReturnTo
+		err = session.Save(r, w)
+		if err != nil {
+			log.Printf("failed to save session: %v\n", err)
+		}
+	}
+
+	status := http.StatusBadRequest
+	switch errorCode {
+	case "server_error":
+		status = http.StatusBadGateway
+	case "temporarily_unavailable":
+		status = http.StatusServiceUnavailable
+	}
+
+	details := fmt.Sprintf("error response from HelseID: error=%q error_description=%q error_uri=%q", errorCode, query.Get("error_description"), query.Get("error_uri"))
+	renderError(w, r, status, errorCode, details, returnTo)
+}
+
+func renderError(w http.ResponseWriter, r *http.Request, status int, code, details, returnTo string) {
+	errorpage.Render(w, r, errorpage.Error{
+		Status:   status,
+		Code:     code,
+		Details:  details,
+		ReturnTo: returnTo,
+	})
 }
@@ -0,0 +1,45 @@
+package frontchannellogout
+
+import (
+	"fmt"
+	"helseid-webapp/auth"
+	"helseid-webapp/sessionstorage"
+	"log"
+	"net/http"
+)
+
+// Loaded by HelseID in a hidden iframe in the browser of the user when the user logs out of HelseID.
+// Destroys the sessions belonging to the HelseID session (sid) given in the request (OpenID Connect Front-Channel Logout 1.0).
+func FrontchannelLogoutHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-cache, no-store")
+
+	iss := r.URL.Query().Get("iss")
+	sid := r.URL.Query().Get("sid")
+	if iss != auth.HelseidMetadata.Issuer {
+		http.Error(w, "Invalid iss parameter", http.StatusBadRequest)
+		return
+	}
+	if sid == "" {
+		http.Error(w, "Missing sid parameter", http.StatusBadRequest)
+		return
+	}
+
+	err := sessionstorage.DestroyBySid(sid)
+	if err != nil {
+		log.Printf("failed to destroy session: %v\n", err)
+		http.Error(w, "Failed to destroy session", http.StatusInternalServerError)
+		return
+	}
+
+	// the browser may also send the session cookie, it is deleted if it belongs to the sid
+	session, err := sessionstorage.Store.Get(r, "auth-session")
+	if err == nil && session.Values["sid"] == sid {
+		http.SetCookie(w, &http.Cookie{
+			Name:   "auth-session",
+			Path:   "/",
+			MaxAge: -1,
+		})
+	}
+
+	fmt.Fprint(w, "<!DOCTYPE html><html><body>Logged out</body></html>")
+}
@@ -1,12 +1,23 @@
 package home
 
 import (
-	"html/template"
+	"helseid-webapp/idp"
+	"helseid-webapp/returnto"
+	"helseid-webapp/routes/logout"
+	"helseid-webapp/templates"
 	"net/http"
 )
 
-var homeTemplate, _ = template.ParseFiles("routes/home/home.html")
-
 func HomeHandler(w http.ResponseWriter, r *http.Request) {
-	homeTemplate.Execute(w, nil)
+	// the login form carries the url the user was sent here from, so the user is sent back to it after login
+	returnTo, _ := returnto.Validate(r.URL.Query().Get(returnto.QueryParameter))
+
+	templates.Render(w, r, http.StatusOK, "home", map[string]interface{}{
+		"returnTo":          returnTo,
+		"identityProviders": idp.IdentityProviders,
+		// the identity provider the user chose the last time is preselected
+		"lastIdp": idp.Remembered(r),
+		// HelseID redirects the user here after a global logout
+		"loggedOut": logout.VerifyLogoutState(w, r),
+	})
 }
@@ -0,0 +1,138 @@
+package inspector
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"helseid-webapp/auth"
+	"helseid-webapp/sessionstorage"
+	"helseid-webapp/templates"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A decoded JWT, the signature is not verified.
+type decodedToken struct {
+	Name    string
+	Header  string
+	Payload string
+	Expiry  string
+	Error   string
+}
+
+type claim struct {
+	Name  string
+	Value string
+}
+
+// Shows all claims of the user and the decoded tokens in the session, only for developers.
+// The route is not registered when auth.DevelopmentMode is false.
+func InspectorHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := sessionstorage.Store.Get(r, "auth-session")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	claims, _ := session.Values["claims"].(map[string]interface{})
+	idToken, _ := session.Values["id_token"].(string)
+
+	tokens := []decodedToken{decodeToken("id token", idToken)}
+	if token, ok := sessionstorage.GetToken(session); ok {
+		tokens = append(tokens, decodeToken("access token for "+auth.DefaultApi, token.AccessToken))
+	}
+	for id, api := range auth.Apis {
+		if token, ok := sessionstorage.GetApiToken(session, api.Resource); ok {
+			tokens = append(tokens, decodeToken("access token for "+id, token.AccessToken))
+		}
+	}
+
+	// the token for the userinfo endpoint is cached without a resource indicator
+	if token, ok := sessionstorage.GetApiToken(session, ""); ok {
+		tokens = append(tokens, decodeToken("access token for the userinfo endpoint", token.AccessToken))
+	}
+
+	_, hasRefreshToken := session.Values["refresh_token"]
+
+	data := map[string]interface{}{
+		"securityLevel":   claims["helseid://claims/identity/security_level"],
+		"assuranceLevel":  claims["helseid://claims/identity/assurance_level"],
+		"claims":          sortClaims(claims),
+		"userInfo":        sortClaims(session.Values["userinfo"]),
+		"tokens":          tokens,
+		"hasRefreshToken": hasRefreshToken,
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	templates.Render(w, r, http.StatusOK, "inspector", data)
+}
+
+func decodeToken(name, raw string) decodedToken {
+	token := decodedToken{Name: name}
+
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		token.Error = "not a signed JWT"
+		return token
+	}
+
+	header, err := decodeSegment(parts[0])
+	if err != nil {
+		token.Error = err.Error()
+		return token
+	}
+	payload, err := decodeSegment(parts[1])
+	if err != nil {
+		token.Error = err.Error()
+		return token
+	}
+	token.Header = header
+	token.Payload = payload
+
+	var registered struct {
+		Expiry int64 `json:"exp"`
+	}
+	if json.Unmarshal([]byte(payload), &registered) == nil && registered.Expiry > 0 {
+		expiry := time.Unix(registered.Expiry, 0)
+		token.Expiry = expiry.Format(time.RFC3339)
+		if expiry.Before(time.Now()) {
+			token.Expiry += " (expired)"
+		} else {
+			token.Expiry += " (in " + time.Until(expiry).Round(time.Second).String() + ")"
+		}
+	}
+
+	return token
+}
+
+// Decodes a base64url encoded JSON segment of a JWT, and indents the JSON.
+func decodeSegment(segment string) (string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return "", errors.New("malformed JWT")
+	}
+
+	var indented bytes.Buffer
+	err = json.Indent(&indented, data, "", "  ")
+	if err != nil {
+		return "", errors.New("malformed JWT")
+	}
+	return indented.String(), nil
+}
+
+// Returns the claims sorted by name, with the values as JSON.
+func sortClaims(value interface{}) []claim {
+	claimsMap, _ := value.(map[string]interface{})
+
+	claims := []claim{}
+	for name, value := range claimsMap {
+		valueJson, _ := json.Marshal(value)
+		claims = append(claims, claim{Name: name, Value: string(valueJson)})
+	}
+	sort.Slice(claims, func(i, j int) bool { return claims[i].Name < claims[j].Name })
+
+	return claims
+}
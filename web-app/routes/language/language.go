@@ -0,0 +1,24 @@
+package language
+
+import (
+	"helseid-webapp/i18n"
+	"helseid-webapp/returnto"
+	"net/http"
+)
+
+// Saves the language chosen with the language toggle and sends the user back to the page the user came from,
+// with the query of the page, e.g. the return_to of the home page. The page must be in the app, otherwise
+// the user is sent to the home page.
+func LanguageHandler(w http.ResponseWriter, r *http.Request) {
+	if !i18n.SetLanguage(w, r.URL.Query().Get("lang")) {
+		http.Error(w, "Unsupported language", http.StatusBadRequest)
+		return
+	}
+
+	returnTo, ok := returnto.ValidateLocal(r.URL.Query().Get(returnto.QueryParameter))
+	if !ok {
+		returnTo = "/"
+	}
+
+	http.Redirect(w, r, returnTo, http.StatusSeeOther)
+}
@@ -2,13 +2,85 @@ package login
 
 import (
 	"helseid-webapp/auth"
+	"helseid-webapp/i18n"
+	"helseid-webapp/idp"
+	"helseid-webapp/organization"
+	"helseid-webapp/returnto"
 	"helseid-webapp/sessionstorage"
 	"net/http"
+	"net/url"
+	"time"
 
 	"golang.org/x/oauth2"
 )
 
+// The values of prompt the user can choose on the home page: login makes the user log in again even if the user
+// is logged in at HelseID, select_account lets the user choose another account.
+var allowedPrompts = map[string]bool{"": true, "login": true, "select_account": true}
+
 func LoginHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	transaction := sessionstorage.LoginTransaction{
+		ReturnTo:  returnto.ValidOrDefault(query.Get(returnto.QueryParameter)),
+		Prompt:    query.Get("prompt"),
+		LoginHint: query.Get("login_hint"),
+	}
+
+	if !allowedPrompts[transaction.Prompt] {
+		http.Error(w, "Unsupported prompt", http.StatusBadRequest)
+		return
+	}
+
+	// the identity provider chosen on the home page is remembered for the next login, the user has chosen
+	// to choose the identity provider at HelseID if idp is empty. Logins started from other pages,
+	// e.g. "try again" on the error page, use the identity provider the user chose the last time.
+	if _, ok := query["idp"]; ok {
+		transaction.Idp = query.Get("idp")
+		if transaction.Idp != "" {
+			if _, err := idp.Find(transaction.Idp); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		idp.Remember(w, transaction.Idp)
+	} else {
+		transaction.Idp = idp.Remembered(r)
+	}
+
+	// the user must choose the organization to log in on behalf of before login
+	if organization.SelectBeforeLogin {
+		orgNrChild := query.Get("organization")
+		if orgNrChild == "" {
+			http.Redirect(w, r, "/organization?"+organizationQuery(transaction).Encode(), http.StatusSeeOther)
+			return
+		}
+
+		selected, err := organization.Find(r, orgNrChild)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		transaction.Organization = selected
+	}
+
+	StartLogin(w, r, transaction)
+}
+
+// The parameters of /login that /organization sends back to /login together with the chosen organization.
+func organizationQuery(transaction sessionstorage.LoginTransaction) url.Values {
+	query := url.Values{returnto.QueryParameter: {transaction.ReturnTo}}
+	for name, value := range map[string]string{"idp": transaction.Idp, "prompt": transaction.Prompt, "login_hint": transaction.LoginHint} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	return query
+}
+
+// Redirects the user to HelseID to log in. The transaction contains where the user is sent after login,
+// and optionally how the user must authenticate and the organization the user logs in on behalf of.
+// The state, nonce and code verifier of the transaction are generated here.
+func StartLogin(w http.ResponseWriter, r *http.Request, transaction sessionstorage.LoginTransaction) {
 
 	// create session to save values to
 	session, err := sessionstorage.Store.Get(r, "auth-session")
@@ -24,9 +96,6 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// save state
-	session.Values["state"] = state
-
 	// generate code cerifier and code challenge
 	codeVerifier, codeChallenge, err := auth.GenerateCodeVerifierAndChallenge()
 	if err != nil {
@@ -34,17 +103,20 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// save code verifier
-	session.Values["code-verifier"] = codeVerifier
-
 	// generate nonce
 	nonce, err := auth.GenerateNonce()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	// save nonce
-	session.Values["nonce"] = nonce
+	// save state, code verifier and nonce as a login transaction keyed by the state,
+	// so a login started in another tab does not overwrite this one
+	transaction.State = state
+	transaction.Nonce = nonce
+	transaction.CodeVerifier = codeVerifier
+	transaction.Created = time.Now()
+	sessionstorage.SaveLoginTransaction(session, transaction)
 
 	// save the content in session
 	err = session.Save(r, w)
@@ -53,6 +125,49 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// ask for a login meeting the requirement, prompt=login makes the user log in again
+	// when the requirement has a max age, even if the user is logged in at HelseID
+	requirement := transaction.Requirement
+	options := auth.AuthorizationRequestOptions{
+		AcrValues: requirement.RequestedAcrValues(),
+		MaxAge:    requirement.MaxAge,
+		Prompt:    transaction.Prompt,
+		UiLocales: []string{i18n.Language(r)},
+		LoginHint: transaction.LoginHint,
+	}
+	if requirement.MaxAge > 0 {
+		options.Prompt = "login"
+	}
+
+	// send the user directly to the identity provider, instead of letting the user choose it at HelseID
+	if transaction.Idp != "" {
+		options.AcrValues = append(options.AcrValues, idp.AcrValue(transaction.Idp))
+	}
+
+	// ask HelseID to log the user in on behalf of the organization
+	if !transaction.Organization.IsZero() {
+		options.AuthorizationDetails = transaction.Organization.AuthorizationDetails()
+	}
+
+	requestObject, err := auth.GenerateRequestObject(state, nonce, codeChallenge, options)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// push the request object to HelseID and redirect with only client_id and request_uri,
+	// this keeps the parameters of the request out of the url and the browser history
+	if auth.UsePushedAuthorizationRequests {
+		authorizationUrl, err := auth.PushAuthorizationRequest(r.Context(), requestObject)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, authorizationUrl, http.StatusTemporaryRedirect)
+		return
+	}
+
 	// create AuthCodeOptions to append code challenge and nonce to auth code request
 	codeChallengeOpt := oauth2.SetAuthURLParam("code_challenge", codeChallenge)
 	codeChallengeMethodOpt := oauth2.SetAuthURLParam("code_challenge_method", "S256")
@@ -65,7 +180,6 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	requestObject, _ := auth.GenerateRequestObject(state, nonce, codeChallenge)
 	requestObjectOpt := oauth2.SetAuthURLParam("request", requestObject)
 
 	// redirect to HelseID login page
@@ -1,18 +1,25 @@
 package logout
 
 import (
-	"fmt"
+	"crypto/subtle"
 	"helseid-webapp/auth"
 	"helseid-webapp/sessionstorage"
 	"net/http"
 	"net/url"
+	"time"
+
+	"gopkg.in/square/go-jose.v2/jwt"
 )
 
-// Redirects user to helse id logout to logout of helseid globaly.
-// Afterwards the user is redirect back to the provided redirect url.
-// If redirect is not requierd simply delete the cookie "auth-session"
-// and redirect to https://helseid-sts.utvikling.nhn.no/connect/endsession
-// without any parameters.
+// the cookie with the state sent to helseid/endsession, checked when the user is redirected back after logout
+const logoutStateCookie = "logout-state"
+
+// Logs the user out of the app, and if the form value scope is "global" also out of HelseID.
+// The logout must be posted with the CSRF token of the session, so other sites can not log the user out.
+// The token is not required when the user is no longer logged in to the app, e.g. after the session expired.
+// For a global logout the user is redirected to helseid/endsession, and HelseID redirects the user back to
+// the post logout redirect uri with the state. For a local logout the user is redirected to the home page,
+// and stays logged in at HelseID.
 func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	// get the session to retrive id token stored at token exchange
 	session, err := sessionstorage.Store.Get(r, "auth-session")
@@ -21,30 +28,94 @@ func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	logoutUrl, err := url.ParseRequestURI(auth.HelseidMetadata.End_session_endpoint)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// A session that has expired or been destroyed has no claims and no CSRF token. The user is then only logged out,
+	// so the cookie is still cleared and a global logout still ends the HelseID session.
+	if _, loggedIn := session.Values["claims"]; loggedIn && !sessionstorage.VerifyCsrfToken(session, r.PostFormValue("csrf_token")) {
+		http.Error(w, "Invalid CSRF token", http.StatusForbidden)
 		return
 	}
 
-	// get the id token
-	idToken := fmt.Sprintf("%v", session.Values["id_token"])
+	// get the id token before the session is deleted
+	idToken, _ := session.Values["id_token"].(string)
 
-	// delete cookie associated with auth session
-	c := http.Cookie{
+	// delete the session and the cookie associated with it
+	if session.ID != "" {
+		err = sessionstorage.Destroy(session.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	http.SetCookie(w, &http.Cookie{
 		Name:   "auth-session",
+		Path:   "/",
 		MaxAge: -1,
+	})
+
+	if r.PostFormValue("scope") != "global" {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
 	}
-	http.SetCookie(w, &c)
 
-	// add the parameters id_token_hint and post_logout_redirect_uri
-	// both are only required for the user to be redirected after logout
-	// if either is omited the user have to confirm logout at helseID site
-	// and will not be redirected afterwards
+	logoutUrl, err := url.ParseRequestURI(auth.HelseidMetadata.End_session_endpoint)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	state, err := auth.GenerateState()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     logoutStateCookie,
+		Value:    state,
+		Path:     "/",
+		MaxAge:   int((10 * time.Minute).Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	// id_token_hint tells HelseID which session to end, without it the user has to confirm logout
+	// at the HelseID site. An expired id token is still a valid hint (RP-Initiated Logout 1.0 section 2),
+	// if the session has no id token, client_id tells HelseID where the post logout redirect uri is registered.
 	parameters := url.Values{}
-	parameters.Add("id_token_hint", idToken)
+	if isIdToken(idToken) {
+		parameters.Add("id_token_hint", idToken)
+	} else {
+		parameters.Add("client_id", auth.ClientId)
+	}
 	parameters.Add("post_logout_redirect_uri", auth.RedirectLogoutUrl)
+	parameters.Add("state", state)
 	logoutUrl.RawQuery = parameters.Encode()
 
-	http.Redirect(w, r, logoutUrl.String(), http.StatusTemporaryRedirect)
+	http.Redirect(w, r, logoutUrl.String(), http.StatusSeeOther)
+}
+
+// Checks that the state HelseID sent back to the post logout redirect uri is the state of the logout
+// started in this browser, and deletes the state cookie. Returns false if there is no state or it does not match.
+func VerifyLogoutState(w http.ResponseWriter, r *http.Request) bool {
+	state := r.URL.Query().Get("state")
+	cookie, err := r.Cookie(logoutStateCookie)
+	if state == "" || err != nil {
+		return false
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:   logoutStateCookie,
+		Path:   "/",
+		MaxAge: -1,
+	})
+
+	return subtle.ConstantTimeCompare([]byte(state), []byte(cookie.Value)) == 1
+}
+
+// Checks that the value from the session is a JWT, without checking the signature or expiry.
+func isIdToken(idToken string) bool {
+	if idToken == "" {
+		return false
+	}
+	_, err := jwt.ParseSigned(idToken)
+	return err == nil
 }
@@ -1,8 +1,15 @@
 package middlewares
 
 import (
+	"helseid-webapp/organization"
+	"helseid-webapp/returnto"
+	"helseid-webapp/routes/login"
 	"helseid-webapp/sessionstorage"
+	"helseid-webapp/stepup"
 	"net/http"
+	"net/url"
+
+	"github.com/gorilla/sessions"
 )
 
 func IsAuthenticated(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
@@ -14,9 +21,14 @@ func IsAuthenticated(w http.ResponseWriter, r *http.Request, next http.HandlerFu
 	}
 
 	if _, ok := session.Values["claims"]; !ok {
+		// send the user back to the requested url after login
+		if returnTo, ok := returnto.FromRequest(r); ok {
+			http.Redirect(w, r, "/?"+url.Values{returnto.QueryParameter: {returnTo}}.Encode(), http.StatusSeeOther)
+			return
+		}
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 	} else {
-		next(w, r)
+		touch(w, r, next, session)
 	}
 }
 
@@ -31,6 +43,57 @@ func IsNotAuthenticated(w http.ResponseWriter, r *http.Request, next http.Handle
 	if _, ok := session.Values["claims"]; !ok {
 		next(w, r)
 	} else {
-		http.Redirect(w, r, "/user", http.StatusSeeOther)
+		http.Redirect(w, r, returnto.ValidOrDefault(r.URL.Query().Get(returnto.QueryParameter)), http.StatusSeeOther)
+	}
+}
+
+// Middleware that only calls next if the user has logged in as required, e.g. with security level 4
+// or within the last minutes. If the user has logged in, but not as required, a new login meeting
+// the requirement is started, and the user is sent back to the page afterwards.
+func RequireStepUp(requirement stepup.Requirement) func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	return func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		session, err := sessionstorage.Store.Get(r, "auth-session")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		claims, ok := session.Values["claims"].(map[string]interface{})
+		if !ok {
+			IsAuthenticated(w, r, next)
+			return
+		}
+
+		if requirement.Check(claims) == nil {
+			touch(w, r, next, session)
+			return
+		}
+
+		returnTo, ok := returnto.FromRequest(r)
+		if !ok {
+			returnTo = returnto.DefaultUrl
+		}
+
+		// log in again on behalf of the same organization
+		selected, _ := session.Values["organization"].(organization.Organization)
+
+		login.StartLogin(w, r, sessionstorage.LoginTransaction{
+			ReturnTo:     returnTo,
+			Requirement:  requirement,
+			Organization: selected,
+		})
 	}
 }
+
+// Extends the session of the user until the idle timeout, and calls next.
+func touch(w http.ResponseWriter, r *http.Request, next http.HandlerFunc, session *sessions.Session) {
+	if sessionstorage.Touch(session) {
+		err := session.Save(r, w)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	next(w, r)
+}
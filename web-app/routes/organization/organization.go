@@ -0,0 +1,28 @@
+package organization
+
+import (
+	"helseid-webapp/organization"
+	"helseid-webapp/returnto"
+	"helseid-webapp/templates"
+	"net/http"
+)
+
+// Lets the user choose the organization to log in on behalf of, the choice is sent to /login.
+func OrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	organizations, err := organization.Lookup(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]interface{}{
+		"organizations": organizations,
+		"returnTo":      returnto.ValidOrDefault(r.URL.Query().Get(returnto.QueryParameter)),
+		// the login options chosen on the home page are sent back to /login
+		"idp":       r.URL.Query().Get("idp"),
+		"prompt":    r.URL.Query().Get("prompt"),
+		"loginHint": r.URL.Query().Get("login_hint"),
+	}
+
+	templates.Render(w, r, http.StatusOK, "organization", data)
+}
@@ -0,0 +1,29 @@
+package sensitive
+
+import (
+	"helseid-webapp/sessionstorage"
+	"helseid-webapp/templates"
+	"net/http"
+	"time"
+)
+
+// A page that requires security level 4 and a recent login, see the route in server.go.
+func SensitiveHandler(w http.ResponseWriter, r *http.Request) {
+
+	session, err := sessionstorage.Store.Get(r, "auth-session")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	claims, _ := session.Values["claims"].(map[string]interface{})
+	authTime, _ := claims["auth_time"].(float64)
+
+	data := map[string]interface{}{
+		"claims":        claims,
+		"securityLevel": claims["helseid://claims/identity/security_level"],
+		"authTime":      time.Unix(int64(authTime), 0).Format(time.RFC3339),
+	}
+
+	templates.Render(w, r, http.StatusOK, "sensitive", data)
+}
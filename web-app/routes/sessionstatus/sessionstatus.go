@@ -0,0 +1,64 @@
+package sessionstatus
+
+import (
+	"encoding/json"
+	"helseid-webapp/sessionstorage"
+	"net/http"
+	"time"
+)
+
+// Reports whether the user still has an active session, and when it expires. Polled by the user page to detect
+// that the session has been destroyed by back-channel or front-channel logout, and to warn the user before it expires.
+// The request does not extend the session, so polling does not keep the session of an idle user alive.
+func SessionStatusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+
+	status := map[string]interface{}{
+		"active": false,
+	}
+
+	session, err := sessionstorage.Store.Get(r, "auth-session")
+	if err == nil {
+		if _, ok := session.Values["claims"]; ok {
+			status["active"] = true
+		}
+		if expiresAt, ok := sessionstorage.ExpiresAt(session); ok {
+			status["expiresAt"] = expiresAt.Unix()
+			status["expiresIn"] = int64(time.Until(expiresAt).Seconds())
+		}
+	}
+
+	json.NewEncoder(w).Encode(status)
+}
+
+// Called by the user page when the check_session_iframe of HelseID reports that the HelseID session
+// has changed. Destroys the local session so the user has to log in again.
+// The custom header can not be added by a cross-site form or link, which protects the endpoint against CSRF.
+func SessionEndedHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Requested-With") != "check-session" {
+		http.Error(w, "Missing X-Requested-With header", http.StatusBadRequest)
+		return
+	}
+
+	session, err := sessionstorage.Store.Get(r, "auth-session")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if session.ID != "" {
+		err = sessionstorage.Destroy(session.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:   "auth-session",
+		Path:   "/",
+		MaxAge: -1,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
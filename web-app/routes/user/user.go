@@ -1,13 +1,13 @@
 package user
 
 import (
+	"helseid-webapp/auth"
 	"helseid-webapp/sessionstorage"
+	"helseid-webapp/templates"
 	"net/http"
-	"text/template"
+	"time"
 )
 
-var userTemplate, _ = template.ParseFiles("routes/user/user.html")
-
 func UserHandler(w http.ResponseWriter, r *http.Request) {
 
 	session, err := sessionstorage.Store.Get(r, "auth-session")
@@ -16,7 +16,33 @@ func UserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	claims := session.Values["claims"]
+	// the logout form must be posted with the CSRF token of the session
+	csrfToken, created, err := sessionstorage.CsrfToken(session)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if created {
+		err = session.Save(r, w)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	data := map[string]interface{}{
+		"csrfToken":          csrfToken,
+		"claims":             session.Values["claims"],
+		"sessionMonitoring":  auth.SessionMonitoring,
+		"checkSessionIframe": auth.HelseidMetadata.Check_session_iframe,
+		"clientId":           auth.ClientId,
+		"sessionState":       session.Values["session_state"],
+		"developmentMode":    auth.DevelopmentMode,
+	}
+
+	if expiresAt, ok := sessionstorage.ExpiresAt(session); ok {
+		data["sessionExpiresIn"] = int64(time.Until(expiresAt).Seconds())
+	}
 
-	userTemplate.Execute(w, claims)
+	templates.Render(w, r, http.StatusOK, "user", data)
 }
@@ -1,14 +1,25 @@
 package server
 
 import (
+	"helseid-webapp/auth"
+	"helseid-webapp/routes/backchannellogout"
+	"helseid-webapp/routes/bff"
 	"helseid-webapp/routes/callapi"
 	"helseid-webapp/routes/callback"
+	"helseid-webapp/routes/frontchannellogout"
 	"helseid-webapp/routes/home"
+	"helseid-webapp/routes/inspector"
+	"helseid-webapp/routes/language"
 	"helseid-webapp/routes/login"
 	"helseid-webapp/routes/logout"
 	"helseid-webapp/routes/middlewares"
+	"helseid-webapp/routes/organization"
+	"helseid-webapp/routes/sensitive"
+	"helseid-webapp/routes/sessionstatus"
 	"helseid-webapp/routes/user"
+	"helseid-webapp/stepup"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/urfave/negroni"
@@ -22,6 +33,9 @@ func StartServer() {
 		negroni.Wrap(http.HandlerFunc(home.HomeHandler)),
 	))
 	r.HandleFunc("/", home.HomeHandler)
+	// saves the language chosen with the language toggle
+	r.HandleFunc("/language", language.LanguageHandler)
+	r.HandleFunc("/organization", organization.OrganizationHandler)
 	r.HandleFunc("/login", login.LoginHandler)
 	r.HandleFunc("/callback", callback.CallbackHandler)
 	// redirects to homepage if user is not authenticated
@@ -29,8 +43,28 @@ func StartServer() {
 		negroni.HandlerFunc(middlewares.IsAuthenticated),
 		negroni.Wrap(http.HandlerFunc(user.UserHandler)),
 	))
-	r.HandleFunc("/logout", logout.LogoutHandler)
-	r.HandleFunc("/callapi", callapi.CallApiHandler)
+	// requires security level 4 and a login within the last 10 minutes, starts a new login if not
+	r.Handle("/sensitive", negroni.New(
+		negroni.HandlerFunc(middlewares.RequireStepUp(stepup.Requirement{SecurityLevel: 4, MaxAge: 10 * time.Minute})),
+		negroni.Wrap(http.HandlerFunc(sensitive.SensitiveHandler)),
+	))
+	// shows the decoded tokens of the user, only for developers
+	if auth.DevelopmentMode {
+		r.Handle("/dev/tokens", negroni.New(
+			negroni.HandlerFunc(middlewares.IsAuthenticated),
+			negroni.Wrap(http.HandlerFunc(inspector.InspectorHandler)),
+		))
+	}
+	r.HandleFunc("/logout", logout.LogoutHandler).Methods("POST")
+	r.Handle("/callapi", negroni.New(
+		negroni.HandlerFunc(middlewares.IsAuthenticated),
+		negroni.Wrap(http.HandlerFunc(callapi.CallApiHandler)),
+	))
+	r.PathPrefix("/bff/{api}/").HandlerFunc(bff.BffHandler)
+	r.HandleFunc("/backchannel-logout", backchannellogout.BackchannelLogoutHandler).Methods("POST")
+	r.HandleFunc("/frontchannel-logout", frontchannellogout.FrontchannelLogoutHandler)
+	r.HandleFunc("/session/status", sessionstatus.SessionStatusHandler)
+	r.HandleFunc("/session/ended", sessionstatus.SessionEndedHandler).Methods("POST")
 
 	// Important note:
 	// Do not use ListenAndServe(http) use ListenAndServeTLS(https) instead
@@ -0,0 +1,368 @@
+package sessionstorage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A backend keeping the sessions in memory, they are lost when the app is restarted.
+type memoryBackend struct {
+	mutex    sync.Mutex
+	sessions map[string]memorySession
+	// when each session id of a key expires from the index, by key
+	index map[string]map[string]time.Time
+}
+
+type memorySession struct {
+	data    []byte
+	expires time.Time
+}
+
+func newMemoryBackend() *memoryBackend {
+	return &memoryBackend{
+		sessions: map[string]memorySession{},
+		index:    map[string]map[string]time.Time{},
+	}
+}
+
+func (b *memoryBackend) load(sessionId string) ([]byte, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	session, ok := b.sessions[sessionId]
+	if !ok || session.expires.Before(time.Now()) {
+		return nil, errSessionNotFound
+	}
+
+	return session.data, nil
+}
+
+func (b *memoryBackend) save(sessionId string, data []byte, maxAge time.Duration) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.sessions[sessionId] = memorySession{
+		data:    data,
+		expires: time.Now().Add(maxAge),
+	}
+	return nil
+}
+
+func (b *memoryBackend) update(sessionId string, old, data []byte) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	session, ok := b.sessions[sessionId]
+	if !ok {
+		return errSessionNotFound
+	}
+	if !bytes.Equal(session.data, old) {
+		return errSessionChanged
+	}
+	session.data = data
+	b.sessions[sessionId] = session
+	return nil
+}
+
+func (b *memoryBackend) list() ([]string, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	sessionIds := []string{}
+	for sessionId := range b.sessions {
+		sessionIds = append(sessionIds, sessionId)
+	}
+	return sessionIds, nil
+}
+
+func (b *memoryBackend) delete(sessionId string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	delete(b.sessions, sessionId)
+	return nil
+}
+
+func (b *memoryBackend) deleteExpired() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for sessionId, session := range b.sessions {
+		if session.expires.Before(time.Now()) {
+			delete(b.sessions, sessionId)
+		}
+	}
+	for key, sessionIds := range b.index {
+		for sessionId, expires := range sessionIds {
+			if expires.Before(time.Now()) {
+				delete(sessionIds, sessionId)
+			}
+		}
+		if len(sessionIds) == 0 {
+			delete(b.index, key)
+		}
+	}
+	return nil
+}
+
+func (b *memoryBackend) addToIndex(key, sessionId string, maxAge time.Duration) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.index[key] == nil {
+		b.index[key] = map[string]time.Time{}
+	}
+	b.index[key][sessionId] = time.Now().Add(maxAge)
+	return nil
+}
+
+func (b *memoryBackend) getFromIndex(key string) ([]string, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	sessionIds := []string{}
+	for sessionId, expires := range b.index[key] {
+		if expires.After(time.Now()) {
+			sessionIds = append(sessionIds, sessionId)
+		}
+	}
+	return sessionIds, nil
+}
+
+func (b *memoryBackend) deleteIndex(key string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	delete(b.index, key)
+	return nil
+}
+
+// A backend saving each session in a file named session_{id} in a directory.
+// The modification time of the file is set to the time the session expires.
+// Each key of the index is a file named index_{sha-256 of the key} with a session id on each line.
+type fileBackend struct {
+	path string
+	// serializes reads and writes of the files
+	mutex sync.RWMutex
+}
+
+// Creates the directory if it does not exist. Only the user running the app may access the directory,
+// since the sessions of all users are stored in it.
+func newFileBackend(path string) (*fileBackend, error) {
+	err := os.MkdirAll(path, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%v is not a directory", path)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("%v can be accessed by other users, the permissions must be 0700", path)
+	}
+
+	return &fileBackend{
+		path: path,
+	}, nil
+}
+
+func (b *fileBackend) filename(sessionId string) string {
+	// the session id is authenticated by the cookie, but never trust it to be a safe filename
+	return filepath.Join(b.path, "session_"+filepath.Base(sessionId))
+}
+
+func (b *fileBackend) load(sessionId string) ([]byte, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	filename := b.filename(sessionId)
+	info, err := os.Stat(filename)
+	if os.IsNotExist(err) {
+		return nil, errSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info.ModTime().Before(time.Now()) {
+		return nil, errSessionNotFound
+	}
+
+	return ioutil.ReadFile(filename)
+}
+
+func (b *fileBackend) save(sessionId string, data []byte, maxAge time.Duration) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	filename := b.filename(sessionId)
+	err := ioutil.WriteFile(filename, data, 0600)
+	if err != nil {
+		return err
+	}
+
+	expires := time.Now().Add(maxAge)
+	return os.Chtimes(filename, expires, expires)
+}
+
+func (b *fileBackend) update(sessionId string, old, data []byte) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	filename := b.filename(sessionId)
+	info, err := os.Stat(filename)
+	if os.IsNotExist(err) {
+		return errSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	current, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(current, old) {
+		return errSessionChanged
+	}
+
+	err = ioutil.WriteFile(filename, data, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Chtimes(filename, info.ModTime(), info.ModTime())
+}
+
+func (b *fileBackend) list() ([]string, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	files, err := ioutil.ReadDir(b.path)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionIds := []string{}
+	for _, file := range files {
+		if strings.HasPrefix(file.Name(), "session_") && !file.IsDir() {
+			sessionIds = append(sessionIds, strings.TrimPrefix(file.Name(), "session_"))
+		}
+	}
+	return sessionIds, nil
+}
+
+func (b *fileBackend) delete(sessionId string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	err := os.Remove(b.filename(sessionId))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (b *fileBackend) deleteExpired() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	files, err := ioutil.ReadDir(b.path)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if !(strings.HasPrefix(file.Name(), "session_") || strings.HasPrefix(file.Name(), "index_")) || file.IsDir() {
+			continue
+		}
+		if file.ModTime().Before(time.Now()) {
+			err = os.Remove(filepath.Join(b.path, file.Name()))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (b *fileBackend) indexFilename(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return filepath.Join(b.path, "index_"+hex.EncodeToString(hash[:]))
+}
+
+func (b *fileBackend) addToIndex(key, sessionId string, maxAge time.Duration) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	sessionIds, err := b.readIndex(key)
+	if err != nil {
+		return err
+	}
+
+	// the ids of the sessions that have been deleted are removed, so the file does not grow forever
+	kept := []string{}
+	for _, existing := range sessionIds {
+		_, err := os.Stat(b.filename(existing))
+		if err == nil && existing != sessionId {
+			kept = append(kept, existing)
+		}
+	}
+	kept = append(kept, sessionId)
+
+	filename := b.indexFilename(key)
+	err = ioutil.WriteFile(filename, []byte(strings.Join(kept, "\n")), 0600)
+	if err != nil {
+		return err
+	}
+
+	expires := time.Now().Add(maxAge)
+	return os.Chtimes(filename, expires, expires)
+}
+
+func (b *fileBackend) getFromIndex(key string) ([]string, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	return b.readIndex(key)
+}
+
+func (b *fileBackend) readIndex(key string) ([]string, error) {
+	data, err := ioutil.ReadFile(b.indexFilename(key))
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sessionIds := []string{}
+	for _, sessionId := range strings.Split(string(data), "\n") {
+		if sessionId != "" {
+			sessionIds = append(sessionIds, sessionId)
+		}
+	}
+	return sessionIds, nil
+}
+
+func (b *fileBackend) deleteIndex(key string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	err := os.Remove(b.indexFilename(key))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package sessionstorage
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+
+	"github.com/gorilla/sessions"
+)
+
+// Returns the CSRF token of the session, which forms posting to the app must include.
+// A new token is created if the session does not have one, the caller must then save the session.
+func CsrfToken(session *sessions.Session) (string, bool, error) {
+	if token, ok := session.Values["csrf_token"].(string); ok {
+		return token, false, nil
+	}
+
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", false, err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(b)
+	session.Values["csrf_token"] = token
+	return token, true, nil
+}
+
+// Checks that token is the CSRF token of the session.
+func VerifyCsrfToken(session *sessions.Session, token string) bool {
+	expected, ok := session.Values["csrf_token"].(string)
+	return ok && token != "" && subtle.ConstantTimeCompare([]byte(expected), []byte(token)) == 1
+}
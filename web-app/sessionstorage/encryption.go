@@ -0,0 +1,163 @@
+package sessionstorage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Encrypts the content of the sessions with AES-GCM, the session id is used as additional data
+// so the encrypted content of one session can not be moved to another session.
+// The first key is used to encrypt, all keys can be used to decrypt.
+type sessionCipher struct {
+	primaryKeyId string
+	keys         map[string]cipher.AEAD
+}
+
+// Parses keys in the format "keyId:base64 encoded key,keyId:base64 encoded key", the first key is the primary key.
+// The keys must be 16, 24 or 32 bytes (AES-128, AES-192 or AES-256).
+func newSessionCipher(keysConfig string) (*sessionCipher, error) {
+	c := &sessionCipher{
+		keys: map[string]cipher.AEAD{},
+	}
+
+	for _, keyConfig := range strings.Split(keysConfig, ",") {
+		parts := strings.SplitN(strings.TrimSpace(keyConfig), ":", 2)
+		if len(parts) != 2 || parts[0] == "" || len(parts[0]) > 255 {
+			return nil, errors.New("session encryption keys must be in the format keyId:base64 encoded key")
+		}
+
+		key, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("session encryption key %v is not base64 encoded: %v", parts[0], err)
+		}
+
+		err = c.addKey(parts[0], key)
+		if err != nil {
+			return nil, fmt.Errorf("session encryption key %v: %v", parts[0], err)
+		}
+	}
+
+	return c, nil
+}
+
+// Creates a cipher with a random key, the sessions can not be decrypted after the app is restarted.
+func newRandomSessionCipher() (*sessionCipher, error) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &sessionCipher{
+		keys: map[string]cipher.AEAD{},
+	}
+	return c, c.addKey("random", key)
+}
+
+func (c *sessionCipher) addKey(keyId string, key []byte) error {
+	if _, ok := c.keys[keyId]; ok {
+		return errors.New("duplicate key id")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+
+	if c.primaryKeyId == "" {
+		c.primaryKeyId = keyId
+	}
+	c.keys[keyId] = aead
+	return nil
+}
+
+// Encrypts with the primary key. The result is: length of key id (1 byte), key id, nonce, ciphertext.
+func (c *sessionCipher) encrypt(sessionId string, plaintext []byte) ([]byte, error) {
+	aead := c.keys[c.primaryKeyId]
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	data := append([]byte{byte(len(c.primaryKeyId))}, c.primaryKeyId...)
+	data = append(data, nonce...)
+	return aead.Seal(data, nonce, plaintext, []byte(sessionId)), nil
+}
+
+// Decrypts data encrypted with any of the keys, and returns the id of the key it was encrypted with.
+func (c *sessionCipher) decrypt(sessionId string, data []byte) ([]byte, string, error) {
+	if len(data) < 1 || len(data) < 1+int(data[0]) {
+		return nil, "", errors.New("malformed encrypted session")
+	}
+	keyId := string(data[1 : 1+int(data[0])])
+	data = data[1+int(data[0]):]
+
+	aead, ok := c.keys[keyId]
+	if !ok {
+		return nil, keyId, fmt.Errorf("session is encrypted with unknown key %v", keyId)
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, keyId, errors.New("malformed encrypted session")
+	}
+
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(sessionId))
+	if err != nil {
+		return nil, keyId, err
+	}
+
+	return plaintext, keyId, nil
+}
+
+// Encrypts all sessions that are encrypted with a retired key again with the primary key.
+// A session is only replaced if it has not been saved since it was loaded, so a session saved by a request
+// while this runs is not overwritten with older content. A session saved by a request is encrypted with the
+// primary key anyway. Sessions that can not be decrypted with any of the keys are left to expire,
+// they are treated as new sessions when they are loaded.
+func (s *serverSideStore) reEncrypt() (int, error) {
+	sessionIds, err := s.backend.list()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, sessionId := range sessionIds {
+		data, err := s.backend.load(sessionId)
+		if err == errSessionNotFound {
+			continue
+		}
+		if err != nil {
+			return count, err
+		}
+
+		plaintext, keyId, err := s.cipher.decrypt(sessionId, data)
+		if err != nil || keyId == s.cipher.primaryKeyId {
+			continue
+		}
+
+		encrypted, err := s.cipher.encrypt(sessionId, plaintext)
+		if err != nil {
+			return count, err
+		}
+		err = s.backend.update(sessionId, data, encrypted)
+		if err == errSessionNotFound || err == errSessionChanged {
+			continue
+		}
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
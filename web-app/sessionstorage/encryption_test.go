@@ -0,0 +1,266 @@
+package sessionstorage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+var testKeys = map[string]string{
+	"old":   base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)),
+	"new":   base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32)),
+	"other": base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{3}, 16)),
+}
+
+func mustSessionCipher(t *testing.T, keysConfig string) *sessionCipher {
+	c, err := newSessionCipher(keysConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestNewSessionCipher(t *testing.T) {
+	tests := []struct {
+		name        string
+		keysConfig  string
+		wantPrimary string
+		wantErr     bool
+	}{
+		{name: "one key", keysConfig: "old:" + testKeys["old"], wantPrimary: "old"},
+		{name: "first key is primary", keysConfig: "new:" + testKeys["new"] + ", old:" + testKeys["old"], wantPrimary: "new"},
+		{name: "aes-128 key", keysConfig: "other:" + testKeys["other"], wantPrimary: "other"},
+		{name: "missing key id", keysConfig: ":" + testKeys["old"], wantErr: true},
+		{name: "missing key", keysConfig: "old", wantErr: true},
+		{name: "not base64", keysConfig: "old:not base64", wantErr: true},
+		{name: "wrong key size", keysConfig: "old:" + base64.StdEncoding.EncodeToString([]byte("short")), wantErr: true},
+		{name: "duplicate key id", keysConfig: "old:" + testKeys["old"] + ",old:" + testKeys["new"], wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := newSessionCipher(test.keysConfig)
+			if test.wantErr {
+				if err == nil {
+					t.Error("got no error, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.primaryKeyId != test.wantPrimary {
+				t.Errorf("got primary key %v, want %v", c.primaryKeyId, test.wantPrimary)
+			}
+		})
+	}
+}
+
+func TestSessionCipherDecrypt(t *testing.T) {
+	oldCipher := mustSessionCipher(t, "old:"+testKeys["old"])
+	rotatedCipher := mustSessionCipher(t, "new:"+testKeys["new"]+",old:"+testKeys["old"])
+	plaintext := []byte("session values")
+
+	encryptedWithOld, err := oldCipher.encrypt("session-1", plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptedWithNew, err := rotatedCipher.encrypt("session-1", plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := append([]byte{}, encryptedWithOld...)
+	tampered[len(tampered)-1] ^= 1
+
+	tests := []struct {
+		name      string
+		cipher    *sessionCipher
+		sessionId string
+		data      []byte
+		wantKeyId string
+		wantErr   bool
+	}{
+		{name: "same key", cipher: oldCipher, sessionId: "session-1", data: encryptedWithOld, wantKeyId: "old"},
+		{name: "rotated key", cipher: rotatedCipher, sessionId: "session-1", data: encryptedWithOld, wantKeyId: "old"},
+		{name: "primary key", cipher: rotatedCipher, sessionId: "session-1", data: encryptedWithNew, wantKeyId: "new"},
+		{name: "removed key", cipher: mustSessionCipher(t, "new:"+testKeys["new"]), sessionId: "session-1", data: encryptedWithOld, wantErr: true},
+		{name: "same key id with another key", cipher: mustSessionCipher(t, "old:"+testKeys["new"]), sessionId: "session-1", data: encryptedWithOld, wantErr: true},
+		{name: "another session", cipher: oldCipher, sessionId: "session-2", data: encryptedWithOld, wantErr: true},
+		{name: "tampered", cipher: oldCipher, sessionId: "session-1", data: tampered, wantErr: true},
+		{name: "truncated", cipher: oldCipher, sessionId: "session-1", data: encryptedWithOld[:5], wantErr: true},
+		{name: "empty", cipher: oldCipher, sessionId: "session-1", data: []byte{}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, keyId, err := test.cipher.decrypt(test.sessionId, test.data)
+			if test.wantErr {
+				if err == nil {
+					t.Error("got no error, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, plaintext) {
+				t.Errorf("got plaintext %q, want %q", got, plaintext)
+			}
+			if keyId != test.wantKeyId {
+				t.Errorf("got key id %v, want %v", keyId, test.wantKeyId)
+			}
+		})
+	}
+}
+
+func TestReEncrypt(t *testing.T) {
+	oldCipher := mustSessionCipher(t, "old:"+testKeys["old"])
+	rotatedCipher := mustSessionCipher(t, "new:"+testKeys["new"]+",old:"+testKeys["old"])
+	unknownCipher := mustSessionCipher(t, "other:"+testKeys["other"])
+
+	tests := []struct {
+		name      string
+		encryptor *sessionCipher
+		// saves other content in the session after reEncrypt has loaded it
+		changed   bool
+		wantCount int
+		wantKeyId string
+	}{
+		{name: "retired key", encryptor: oldCipher, wantCount: 1, wantKeyId: "new"},
+		{name: "primary key", encryptor: rotatedCipher, wantCount: 0, wantKeyId: "new"},
+		{name: "unknown key", encryptor: unknownCipher, wantCount: 0, wantKeyId: "other"},
+		{name: "saved while re-encrypting", encryptor: oldCipher, changed: true, wantCount: 0, wantKeyId: "new"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			backend := newMemoryBackend()
+			encrypted, err := test.encryptor.encrypt("session-1", []byte("old values"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = backend.save("session-1", encrypted, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var store *serverSideStore
+			if test.changed {
+				// a request saves the session, encrypted with the primary key, between the load and the update
+				changing := &changingBackend{memoryBackend: backend, change: func() {
+					saved, err := rotatedCipher.encrypt("session-1", []byte("new values"))
+					if err != nil {
+						t.Fatal(err)
+					}
+					backend.save("session-1", saved, time.Hour)
+				}}
+				store = newServerSideStore(changing, &sessions.Options{}, []byte("hash key"), rotatedCipher)
+			} else {
+				store = newServerSideStore(backend, &sessions.Options{}, []byte("hash key"), rotatedCipher)
+			}
+
+			count, err := store.reEncrypt()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != test.wantCount {
+				t.Errorf("got %v re-encrypted sessions, want %v", count, test.wantCount)
+			}
+
+			data, err := backend.load("session-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if keyId := string(data[1 : 1+int(data[0])]); keyId != test.wantKeyId {
+				t.Errorf("got session encrypted with %v, want %v", keyId, test.wantKeyId)
+			}
+
+			if test.wantKeyId == "new" {
+				plaintext, _, err := rotatedCipher.decrypt("session-1", data)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := "old values"
+				if test.changed {
+					want = "new values"
+				}
+				if string(plaintext) != want {
+					t.Errorf("got session content %q, want %q", plaintext, want)
+				}
+			}
+		})
+	}
+}
+
+// A backend that runs change once after the first load, to simulate a request saving the session concurrently.
+type changingBackend struct {
+	*memoryBackend
+	change func()
+}
+
+func (b *changingBackend) load(sessionId string) ([]byte, error) {
+	data, err := b.memoryBackend.load(sessionId)
+	if b.change != nil {
+		b.change()
+		b.change = nil
+	}
+	return data, err
+}
+
+func TestStoreWithRotatedKey(t *testing.T) {
+	backend := newMemoryBackend()
+	hashKey := []byte("0123456789abcdef0123456789abcdef")
+	options := &sessions.Options{Path: "/", MaxAge: 3600}
+
+	// a session saved before the key was rotated
+	oldStore := newServerSideStore(backend, options, hashKey, mustSessionCipher(t, "old:"+testKeys["old"]))
+	r := httptest.NewRequest("GET", "https://localhost/", nil)
+	session, err := oldStore.New(r, "auth-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Values["name"] = "Kari Nordmann"
+	w := httptest.NewRecorder()
+	err = oldStore.Save(r, w, session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookie := w.Result().Cookies()[0]
+
+	tests := []struct {
+		name       string
+		keysConfig string
+		wantValue  bool
+	}{
+		{name: "old key is primary", keysConfig: "old:" + testKeys["old"], wantValue: true},
+		{name: "old key is retired", keysConfig: "new:" + testKeys["new"] + ",old:" + testKeys["old"], wantValue: true},
+		{name: "old key is removed", keysConfig: "new:" + testKeys["new"], wantValue: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newServerSideStore(backend, options, hashKey, mustSessionCipher(t, test.keysConfig))
+			r := httptest.NewRequest("GET", "https://localhost/", nil)
+			r.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+
+			session, err := store.New(r, "auth-session")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			name, _ := session.Values["name"].(string)
+			if test.wantValue && (session.IsNew || name != "Kari Nordmann") {
+				t.Errorf("got a new session with name %q, want the saved session", name)
+			}
+			if !test.wantValue && (!session.IsNew || name != "") {
+				t.Errorf("got the saved session, want a new session")
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package sessionstorage
+
+// Index from the HelseID session (sid) and the user (sub) to the ids of the sessions in the store,
+// used to find the sessions to destroy when HelseID tells the app that a user has logged out.
+// The index is kept in the backend of the store, so with the redis backend a logout received by one replica
+// destroys the sessions created by all replicas. The entries expire with the absolute timeout of the sessions.
+var indexBackend backend
+
+// Records that the session with sessionId belongs to the HelseID session sid and the user sub.
+func IndexSession(sessionId, sid, sub string) error {
+	if sid != "" {
+		err := indexBackend.addToIndex("sid:"+sid, sessionId, absoluteTimeout)
+		if err != nil {
+			return err
+		}
+	}
+	if sub != "" {
+		err := indexBackend.addToIndex("sub:"+sub, sessionId, absoluteTimeout)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Destroys the sessions belonging to the HelseID session sid.
+func DestroyBySid(sid string) error {
+	return destroyByIndex("sid:" + sid)
+}
+
+// Destroys all sessions belonging to the user sub.
+func DestroyBySub(sub string) error {
+	return destroyByIndex("sub:" + sub)
+}
+
+// Deletes the session with the given id from the store. The id is left in the index,
+// destroying a session that has already been deleted does nothing.
+func Destroy(sessionId string) error {
+	return Store.Destroy(sessionId)
+}
+
+func destroyByIndex(key string) error {
+	sessionIds, err := indexBackend.getFromIndex(key)
+	if err != nil {
+		return err
+	}
+
+	for _, sessionId := range sessionIds {
+		err = Destroy(sessionId)
+		if err != nil {
+			return err
+		}
+	}
+
+	return indexBackend.deleteIndex(key)
+}
@@ -0,0 +1,69 @@
+package sessionstorage
+
+import (
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// how often the time of the last activity is updated, to not save the session on every request
+const touchInterval = time.Minute
+
+// Starts the lifetime of the session when the user has logged in. The caller must save the session afterwards.
+func StartLifetime(session *sessions.Session) {
+	now := time.Now().Unix()
+	session.Values["authenticated_at"] = now
+	session.Values["last_activity"] = now
+}
+
+// Records that the user is active, which extends the session until the idle timeout.
+// Returns true if the session was changed and must be saved.
+func Touch(session *sessions.Session) bool {
+	lastActivity, ok := session.Values["last_activity"].(int64)
+	if !ok || time.Since(time.Unix(lastActivity, 0)) < touchInterval {
+		return false
+	}
+
+	session.Values["last_activity"] = time.Now().Unix()
+	return true
+}
+
+// Returns when the session of the logged in user expires, the earliest of:
+// the absolute timeout after login, the idle timeout after the last activity,
+// and the expiry of the access token if it can not be refreshed.
+// Returns false if the user has not logged in.
+func ExpiresAt(session *sessions.Session) (time.Time, bool) {
+	return expiresAt(session.Values)
+}
+
+func expiresAt(values map[interface{}]interface{}) (time.Time, bool) {
+	authenticatedAt, ok := values["authenticated_at"].(int64)
+	if !ok {
+		return time.Time{}, false
+	}
+	lastActivity, _ := values["last_activity"].(int64)
+
+	expires := time.Unix(authenticatedAt, 0).Add(absoluteTimeout)
+	if idle := time.Unix(lastActivity, 0).Add(idleTimeout); idle.Before(expires) {
+		expires = idle
+	}
+
+	// without a refresh token the user must log in again to get a new access token
+	if _, ok := values["refresh_token"].(string); !ok {
+		if tokenExpiry, ok := values["token_expiry"].(int64); ok && tokenExpiry > 0 && time.Unix(tokenExpiry, 0).Before(expires) {
+			expires = time.Unix(tokenExpiry, 0)
+		}
+	}
+
+	return expires, true
+}
+
+func isExpired(values map[interface{}]interface{}) bool {
+	expires, ok := expiresAt(values)
+	if !ok {
+		// a session the user logged in to before the timeouts were introduced
+		_, loggedIn := values["claims"]
+		return loggedIn
+	}
+	return time.Now().After(expires)
+}
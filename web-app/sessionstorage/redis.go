@@ -0,0 +1,294 @@
+package sessionstorage
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const redisKeyPrefix = "helseid-webapp:session:"
+const redisIndexPrefix = "helseid-webapp:index:"
+const redisTimeout = 5 * time.Second
+
+// A backend saving the sessions in a server speaking the Redis protocol (RESP), e.g. Redis or Valkey.
+// Expired sessions are deleted by the server.
+type redisBackend struct {
+	address  string
+	password string
+
+	// a single connection is shared, requests are serialized
+	mutex  sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newRedisBackend(address, password string) (*redisBackend, error) {
+	b := &redisBackend{
+		address:  address,
+		password: password,
+	}
+
+	_, err := b.do("PING")
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func (b *redisBackend) load(sessionId string) ([]byte, error) {
+	reply, err := b.do("GET", redisKeyPrefix+sessionId)
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		return nil, errSessionNotFound
+	}
+
+	data, ok := reply.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("unexpected reply to GET: %v", reply)
+	}
+	return data, nil
+}
+
+func (b *redisBackend) save(sessionId string, data []byte, maxAge time.Duration) error {
+	_, err := b.do("SET", redisKeyPrefix+sessionId, string(data), "EX", redisSeconds(maxAge))
+	return err
+}
+
+// The content is compared and replaced by a script, which the server runs atomically.
+const redisUpdateScript = `if redis.call("GET", KEYS[1]) ~= ARGV[1] then return 0 end
+redis.call("SET", KEYS[1], ARGV[2], "XX", "KEEPTTL")
+return 1`
+
+func (b *redisBackend) update(sessionId string, old, data []byte) error {
+	// requires Redis 6.0 or newer
+	reply, err := b.do("EVAL", redisUpdateScript, "1", redisKeyPrefix+sessionId, string(old), string(data))
+	if err != nil {
+		return err
+	}
+	if updated, _ := reply.(int64); updated != 1 {
+		return errSessionChanged
+	}
+	return nil
+}
+
+func (b *redisBackend) list() ([]string, error) {
+	sessionIds := []string{}
+	cursor := "0"
+	for {
+		reply, err := b.do("SCAN", cursor, "MATCH", redisKeyPrefix+"*", "COUNT", "100")
+		if err != nil {
+			return nil, err
+		}
+
+		// the reply is the next cursor and a list of keys
+		elements, ok := reply.([]interface{})
+		if !ok || len(elements) != 2 {
+			return nil, fmt.Errorf("unexpected reply to SCAN: %v", reply)
+		}
+		nextCursor, _ := elements[0].([]byte)
+		keys, _ := elements[1].([]interface{})
+		for _, key := range keys {
+			if key, ok := key.([]byte); ok {
+				sessionIds = append(sessionIds, strings.TrimPrefix(string(key), redisKeyPrefix))
+			}
+		}
+
+		cursor = string(nextCursor)
+		if cursor == "0" || cursor == "" {
+			return sessionIds, nil
+		}
+	}
+}
+
+func (b *redisBackend) delete(sessionId string) error {
+	_, err := b.do("DEL", redisKeyPrefix+sessionId)
+	return err
+}
+
+// Each key of the index is a set of session ids, which expires maxAge after the last addition.
+func (b *redisBackend) addToIndex(key, sessionId string, maxAge time.Duration) error {
+	_, err := b.do("SADD", redisIndexPrefix+key, sessionId)
+	if err != nil {
+		return err
+	}
+	_, err = b.do("EXPIRE", redisIndexPrefix+key, redisSeconds(maxAge))
+	return err
+}
+
+// The expiry in whole seconds, rounded up. The server rejects EX 0, and EXPIRE 0 deletes the key at once.
+func redisSeconds(maxAge time.Duration) string {
+	seconds := int64((maxAge + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.FormatInt(seconds, 10)
+}
+
+func (b *redisBackend) getFromIndex(key string) ([]string, error) {
+	reply, err := b.do("SMEMBERS", redisIndexPrefix+key)
+	if err != nil {
+		return nil, err
+	}
+
+	members, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected reply to SMEMBERS: %v", reply)
+	}
+	sessionIds := []string{}
+	for _, member := range members {
+		if member, ok := member.([]byte); ok {
+			sessionIds = append(sessionIds, string(member))
+		}
+	}
+	return sessionIds, nil
+}
+
+func (b *redisBackend) deleteIndex(key string) error {
+	_, err := b.do("DEL", redisIndexPrefix+key)
+	return err
+}
+
+// Sends a command and returns the reply. The connection is opened again if it has failed.
+func (b *redisBackend) do(args ...string) (interface{}, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.conn == nil {
+		err := b.connect()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	reply, err := b.send(args...)
+	if err != nil {
+		// the connection can not be reused after a network or protocol error
+		var redisErr redisError
+		if !errors.As(err, &redisErr) {
+			b.conn.Close()
+			b.conn = nil
+		}
+		return nil, err
+	}
+
+	return reply, nil
+}
+
+func (b *redisBackend) connect() error {
+	conn, err := net.DialTimeout("tcp", b.address, redisTimeout)
+	if err != nil {
+		return err
+	}
+	b.conn = conn
+	b.reader = bufio.NewReader(conn)
+
+	if b.password != "" {
+		_, err = b.send("AUTH", b.password)
+		if err != nil {
+			b.conn.Close()
+			b.conn = nil
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *redisBackend) send(args ...string) (interface{}, error) {
+	b.conn.SetDeadline(time.Now().Add(redisTimeout))
+
+	// a command is an array of bulk strings
+	command := fmt.Sprintf("*%d\r\n", len(args))
+	for _, arg := range args {
+		command += fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	_, err := io.WriteString(b.conn, command)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.readReply()
+}
+
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// Reads a reply. Simple strings and bulk strings are returned as []byte,
+// integers as int64, arrays as []interface{} and a null bulk string as nil.
+func (b *redisBackend) readReply() (interface{}, error) {
+	line, err := b.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errors.New("redis: malformed reply")
+	}
+	kind, value := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return []byte(value), nil
+	case '-':
+		return nil, redisError(value)
+	case ':':
+		return strconv.ParseInt(value, 10, 64)
+	case '$':
+		length, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, err
+		}
+		if length < 0 {
+			return nil, nil
+		}
+		data := make([]byte, length+2)
+		_, err = io.ReadFull(b.reader, data)
+		if err != nil {
+			return nil, err
+		}
+		if data[length] != '\r' || data[length+1] != '\n' {
+			return nil, errors.New("redis: malformed bulk string")
+		}
+		return data[:length], nil
+	case '*':
+		length, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, err
+		}
+		if length < 0 {
+			return nil, nil
+		}
+		// an error in an element is returned after all the elements are read, so the connection can be reused
+		var elementErr error
+		elements := make([]interface{}, length)
+		for i := range elements {
+			elements[i], err = b.readReply()
+			var redisErr redisError
+			if errors.As(err, &redisErr) {
+				if elementErr == nil {
+					elementErr = err
+				}
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		if elementErr != nil {
+			return nil, elementErr
+		}
+		return elements, nil
+	}
+
+	return nil, fmt.Errorf("redis: unknown reply type %q", kind)
+}
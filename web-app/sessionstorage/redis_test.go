@@ -0,0 +1,104 @@
+package sessionstorage
+
+import (
+	"bufio"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadReply(t *testing.T) {
+	tests := []struct {
+		name          string
+		reply         string
+		want          interface{}
+		wantErr       bool
+		wantRedisErr  bool
+		wantRemaining string
+	}{
+		{name: "simple string", reply: "+OK\r\n", want: []byte("OK")},
+		{name: "error", reply: "-ERR wrong number of arguments\r\n", wantErr: true, wantRedisErr: true},
+		{name: "integer", reply: ":1\r\n", want: int64(1)},
+		{name: "negative integer", reply: ":-2\r\n", want: int64(-2)},
+		{name: "bulk string", reply: "$5\r\nhello\r\n", want: []byte("hello")},
+		{name: "bulk string with line breaks", reply: "$7\r\na\r\nb\r\nc\r\n", want: []byte("a\r\nb\r\nc")},
+		{name: "empty bulk string", reply: "$0\r\n\r\n", want: []byte{}},
+		{name: "null bulk string", reply: "$-1\r\n", want: nil},
+		{
+			name:  "array",
+			reply: "*2\r\n$1\r\n0\r\n*2\r\n$3\r\nabc\r\n$3\r\ndef\r\n",
+			want:  []interface{}{[]byte("0"), []interface{}{[]byte("abc"), []byte("def")}},
+		},
+		{name: "empty array", reply: "*0\r\n", want: []interface{}{}},
+		{name: "null array", reply: "*-1\r\n", want: nil},
+		{
+			name:          "error in array",
+			reply:         "*2\r\n-ERR failed\r\n:1\r\n+NEXT\r\n",
+			wantErr:       true,
+			wantRedisErr:  true,
+			wantRemaining: "+NEXT\r\n",
+		},
+		{name: "only the first reply is read", reply: "+OK\r\n+NEXT\r\n", want: []byte("OK"), wantRemaining: "+NEXT\r\n"},
+		{name: "empty", reply: "", wantErr: true},
+		{name: "missing carriage return", reply: "+OK\n", wantErr: true},
+		{name: "missing line break", reply: "+OK", wantErr: true},
+		{name: "unknown type", reply: "!OK\r\n", wantErr: true},
+		{name: "malformed integer", reply: ":one\r\n", wantErr: true},
+		{name: "malformed bulk string length", reply: "$five\r\nhello\r\n", wantErr: true},
+		{name: "short bulk string", reply: "$5\r\nhel", wantErr: true},
+		{name: "bulk string longer than its length", reply: "$3\r\nhello\r\n", wantErr: true},
+		{name: "short array", reply: "*2\r\n:1\r\n", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader := bufio.NewReader(strings.NewReader(test.reply))
+			b := &redisBackend{reader: reader}
+
+			got, err := b.readReply()
+			if test.wantErr {
+				var redisErr redisError
+				if err == nil {
+					t.Errorf("got %v, want an error", got)
+				} else if errors.As(err, &redisErr) != test.wantRedisErr {
+					t.Errorf("got error %v, want a redis error: %v", err, test.wantRedisErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %#v, want %#v", got, test.want)
+			}
+
+			if test.wantRemaining != "" {
+				remaining, _ := reader.ReadString('\n')
+				if remaining != test.wantRemaining {
+					t.Errorf("got %q left to read, want %q", remaining, test.wantRemaining)
+				}
+			}
+		})
+	}
+}
+
+func TestRedisSeconds(t *testing.T) {
+	tests := []struct {
+		maxAge time.Duration
+		want   string
+	}{
+		{maxAge: 24 * time.Hour, want: "86400"},
+		{maxAge: time.Second, want: "1"},
+		{maxAge: 1500 * time.Millisecond, want: "2"},
+		{maxAge: 500 * time.Millisecond, want: "1"},
+		{maxAge: time.Nanosecond, want: "1"},
+		{maxAge: 0, want: "1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.maxAge.String(), func(t *testing.T) {
+			if got := redisSeconds(test.maxAge); got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
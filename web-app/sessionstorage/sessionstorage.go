@@ -1,16 +1,193 @@
 package sessionstorage
 
 import (
+	"crypto/rand"
 	"encoding/gob"
+	"fmt"
+	"helseid-webapp/organization"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/gorilla/sessions"
 )
 
-var Store *sessions.FilesystemStore
+// settings
+
+// The backend the sessions are stored in, set with the environment variable SESSION_STORE:
+// "memory" keeps the sessions in memory, they are lost when the app is restarted
+// "file" saves each session in a file in the directory SESSION_STORE_PATH (defaults to helseid-webapp-sessions in the OS temp directory),
+// the directory must only be used for the sessions of the app since expired sessions are deleted from it
+// "redis" saves the sessions in a server speaking the Redis protocol at SESSION_STORE_REDIS_ADDRESS,
+// which is required to run more than one replica of the app
+const storeTypeEnv = "SESSION_STORE"
+const defaultStoreType = "file"
+const storePathEnv = "SESSION_STORE_PATH"
+const defaultStoreDirectory = "helseid-webapp-sessions"
+const redisAddressEnv = "SESSION_STORE_REDIS_ADDRESS"
+const redisPasswordEnv = "SESSION_STORE_REDIS_PASSWORD"
+const defaultRedisAddress = "localhost:6379"
+
+// The key used to authenticate the session cookie, set with the environment variable SESSION_HASH_KEY.
+// It should be a secret and cryptographically random string of at least 32 bytes, and DO NOT store it in source code.
+// All replicas of the app must use the same key.
+const hashKeyEnv = "SESSION_HASH_KEY"
+
+// The keys used to encrypt the sessions with AES-GCM, set with the environment variable SESSION_ENCRYPTION_KEYS
+// in the format "keyId:base64 encoded key,keyId:base64 encoded key". The keys must be 16, 24 or 32 bytes.
+// The first key encrypts, the other keys are retired and only used to decrypt sessions encrypted before the key was rotated.
+// Sessions encrypted with a retired key are encrypted with the first key when the app starts, after that the retired key can be removed.
+// Keep the keys as secret as the hash key, and use the same keys in all replicas of the app.
+const encryptionKeysEnv = "SESSION_ENCRYPTION_KEYS"
+
+// How long a session lasts after login, set with the environment variable SESSION_ABSOLUTE_TIMEOUT, e.g. "8h".
+// The user must log in again after this time even if the user is active.
+const absoluteTimeoutEnv = "SESSION_ABSOLUTE_TIMEOUT"
+const defaultAbsoluteTimeout = 8 * time.Hour
+
+// How long a session lasts after the last request of the user, set with the environment variable SESSION_IDLE_TIMEOUT, e.g. "30m".
+const idleTimeoutEnv = "SESSION_IDLE_TIMEOUT"
+const defaultIdleTimeout = 30 * time.Minute
+
+// how often expired sessions are deleted from the memory and file backends
+const gcInterval = 10 * time.Minute
+
+// A store of server-side sessions, only the session id is stored in the cookie.
+type SessionStore interface {
+	sessions.Store
+	// Deletes the session with the given id from the backend, without access to the request of the user.
+	Destroy(sessionId string) error
+}
+
+var Store SessionStore
+
+var absoluteTimeout = defaultAbsoluteTimeout
+var idleTimeout = defaultIdleTimeout
 
 func Init() error {
-	Store = sessions.NewFilesystemStore("", []byte("this-key-should-be-a-secret-string-not-stored-in-source-code"))
-	Store.MaxLength(16384)
 	gob.Register(map[string]interface{}{})
+	gob.Register(map[string]LoginTransaction{})
+	gob.Register(organization.Organization{})
+	gob.Register(map[string]ApiToken{})
+
+	hashKey := []byte(os.Getenv(hashKeyEnv))
+	if len(hashKey) == 0 {
+		log.Printf("%v is not set, using a random key. Sessions will be lost when the app is restarted.\n", hashKeyEnv)
+		hashKey = make([]byte, 32)
+		_, err := rand.Read(hashKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	var encryption *sessionCipher
+	var err error
+	encryptionKeys := os.Getenv(encryptionKeysEnv)
+	if encryptionKeys == "" {
+		log.Printf("%v is not set, using a random key. Sessions will be lost when the app is restarted.\n", encryptionKeysEnv)
+		encryption, err = newRandomSessionCipher()
+	} else {
+		encryption, err = newSessionCipher(encryptionKeys)
+	}
+	if err != nil {
+		return err
+	}
+
+	absoluteTimeout, err = getDurationEnv(absoluteTimeoutEnv, defaultAbsoluteTimeout)
+	if err != nil {
+		return err
+	}
+	idleTimeout, err = getDurationEnv(idleTimeoutEnv, defaultIdleTimeout)
+	if err != nil {
+		return err
+	}
+
+	storeType := os.Getenv(storeTypeEnv)
+	if storeType == "" {
+		storeType = defaultStoreType
+	}
+
+	var storeBackend backend
+	switch storeType {
+	case "memory":
+		storeBackend = newMemoryBackend()
+	case "file":
+		path := os.Getenv(storePathEnv)
+		if path == "" {
+			path = filepath.Join(os.TempDir(), defaultStoreDirectory)
+		}
+		files, err := newFileBackend(path)
+		if err != nil {
+			return fmt.Errorf("failed to use %v as the session store: %v", path, err)
+		}
+		storeBackend = files
+	case "redis":
+		address := os.Getenv(redisAddressEnv)
+		if address == "" {
+			address = defaultRedisAddress
+		}
+		redis, err := newRedisBackend(address, os.Getenv(redisPasswordEnv))
+		if err != nil {
+			return fmt.Errorf("failed to connect to the session store at %v: %v", address, err)
+		}
+		storeBackend = redis
+	default:
+		return fmt.Errorf("unknown session store %v, must be memory, file or redis", storeType)
+	}
+
+	options := &sessions.Options{
+		Path:     "/",
+		MaxAge:   int(absoluteTimeout.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	store := newServerSideStore(storeBackend, options, hashKey, encryption)
+	store.startGc(gcInterval)
+	Store = store
+	indexBackend = storeBackend
+
+	if len(encryption.keys) > 1 {
+		go func() {
+			count, err := store.reEncrypt()
+			if err != nil {
+				log.Printf("failed to encrypt sessions with the primary key: %v\n", err)
+				return
+			}
+			log.Printf("encrypted %v sessions with the primary key %v\n", count, encryption.primaryKeyId)
+		}()
+	}
+
 	return nil
 }
+
+// Gives the session a new id and saves it, and deletes the session with the old id.
+// Call this when the user has logged in, to prevent session fixation.
+func Regenerate(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	oldSessionId := session.ID
+
+	session.ID = ""
+	err := session.Save(r, w)
+	if err != nil {
+		return err
+	}
+
+	if oldSessionId != "" {
+		return Destroy(oldSessionId)
+	}
+	return nil
+}
+
+func getDurationEnv(name string, defaultValue time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("%v must be a positive duration, e.g. 30m or 8h", name)
+	}
+	return duration, nil
+}
@@ -0,0 +1,201 @@
+package sessionstorage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/gob"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+var errSessionNotFound = errors.New("session not found")
+var errSessionChanged = errors.New("session has changed")
+
+// Where the content of the sessions is stored, by session id.
+type backend interface {
+	// returns errSessionNotFound if there is no session with the id, or it has expired
+	load(sessionId string) ([]byte, error)
+	save(sessionId string, data []byte, maxAge time.Duration) error
+	// replaces the content of an existing session without changing when it expires, if the content is still old.
+	// Returns errSessionChanged if the session has been saved with other content since old was loaded.
+	update(sessionId string, old, data []byte) error
+	delete(sessionId string) error
+	list() ([]string, error)
+
+	// The index from e.g. the HelseID session (sid) of the sessions to their ids is kept in the backend,
+	// so all replicas of the app find the same sessions. The entries of a key expire maxAge after the last addition.
+	addToIndex(key, sessionId string, maxAge time.Duration) error
+	// returns the session ids of the key, some of the sessions may have been deleted
+	getFromIndex(key string) ([]string, error)
+	deleteIndex(key string) error
+}
+
+// A backend that must delete expired sessions itself.
+type collectableBackend interface {
+	backend
+	deleteExpired() error
+}
+
+// A sessions.Store keeping the values of the sessions encrypted in a backend,
+// the cookie only contains the authenticated session id.
+type serverSideStore struct {
+	backend backend
+	options *sessions.Options
+	codecs  []securecookie.Codec
+	cipher  *sessionCipher
+}
+
+func newServerSideStore(backend backend, options *sessions.Options, hashKey []byte, cipher *sessionCipher) *serverSideStore {
+	return &serverSideStore{
+		backend: backend,
+		options: options,
+		codecs:  securecookie.CodecsFromPairs(hashKey),
+		cipher:  cipher,
+	}
+}
+
+func (s *serverSideStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// Returns the session identified by the cookie in the request. If there is no cookie,
+// the cookie is not valid, or the session has been destroyed or expired, a new session is returned.
+func (s *serverSideStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	options := *s.options
+	session.Options = &options
+	session.IsNew = true
+
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+
+	err = securecookie.DecodeMulti(name, cookie.Value, &session.ID, s.codecs...)
+	if err != nil {
+		session.ID = ""
+		return session, nil
+	}
+
+	data, err := s.backend.load(session.ID)
+	if err == errSessionNotFound {
+		session.ID = ""
+		return session, nil
+	}
+	if err != nil {
+		return session, err
+	}
+
+	// a session encrypted with a key that has been removed is treated as a new session
+	data, _, err = s.cipher.decrypt(session.ID, data)
+	if err != nil {
+		log.Printf("failed to decrypt session: %v\n", err)
+		session.ID = ""
+		return session, nil
+	}
+
+	err = gob.NewDecoder(bytes.NewReader(data)).Decode(&session.Values)
+	if err != nil {
+		return session, err
+	}
+
+	// the user must log in again when the session has passed the absolute or idle timeout
+	if isExpired(session.Values) {
+		err = s.backend.delete(session.ID)
+		if err != nil {
+			return session, err
+		}
+		session.ID = ""
+		session.Values = map[interface{}]interface{}{}
+		return session, nil
+	}
+	session.IsNew = false
+
+	return session, nil
+}
+
+// Saves the values of the session in the backend and sets the cookie with the session id.
+// A session with a negative MaxAge is deleted.
+func (s *serverSideStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			err := s.backend.delete(session.ID)
+			if err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if session.ID == "" {
+		sessionId, err := generateSessionId()
+		if err != nil {
+			return err
+		}
+		session.ID = sessionId
+	}
+
+	var data bytes.Buffer
+	err := gob.NewEncoder(&data).Encode(session.Values)
+	if err != nil {
+		return err
+	}
+
+	encrypted, err := s.cipher.encrypt(session.ID, data.Bytes())
+	if err != nil {
+		return err
+	}
+
+	maxAge := time.Duration(session.Options.MaxAge) * time.Second
+	err = s.backend.save(session.ID, encrypted, maxAge)
+	if err != nil {
+		return err
+	}
+
+	encodedSessionId, err := securecookie.EncodeMulti(session.Name(), session.ID, s.codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encodedSessionId, session.Options))
+
+	return nil
+}
+
+func (s *serverSideStore) Destroy(sessionId string) error {
+	return s.backend.delete(sessionId)
+}
+
+// Deletes expired sessions periodically, if the backend does not do it itself.
+func (s *serverSideStore) startGc(interval time.Duration) {
+	collectable, ok := s.backend.(collectableBackend)
+	if !ok {
+		return
+	}
+
+	go func() {
+		for range time.Tick(interval) {
+			err := collectable.deleteExpired()
+			if err != nil {
+				log.Printf("failed to delete expired sessions: %v\n", err)
+			}
+		}
+	}()
+}
+
+func generateSessionId() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(base32.StdEncoding.EncodeToString(b), "="), nil
+}
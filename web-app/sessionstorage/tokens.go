@@ -0,0 +1,87 @@
+package sessionstorage
+
+import (
+	"time"
+
+	"github.com/gorilla/sessions"
+	"golang.org/x/oauth2"
+)
+
+// Saves the tokens from a token response in the session: the access token, refresh token, expiry and scopes.
+// If the response did not contain a new refresh token the refresh token already in the session is kept.
+func SaveToken(session *sessions.Session, token *oauth2.Token) {
+	session.Values["access_token"] = token.AccessToken
+	session.Values["token_type"] = token.TokenType
+	session.Values["token_expiry"] = token.Expiry.Unix()
+
+	if token.RefreshToken != "" {
+		session.Values["refresh_token"] = token.RefreshToken
+	}
+
+	if scope, ok := token.Extra("scope").(string); ok {
+		session.Values["token_scope"] = scope
+	}
+}
+
+// Gets the tokens saved with SaveToken, returns false if there is no access token in the session.
+func GetToken(session *sessions.Session) (*oauth2.Token, bool) {
+	accessToken, ok := session.Values["access_token"].(string)
+	if !ok {
+		return nil, false
+	}
+
+	token := &oauth2.Token{AccessToken: accessToken}
+	token.TokenType, _ = session.Values["token_type"].(string)
+	token.RefreshToken, _ = session.Values["refresh_token"].(string)
+	if expiry, ok := session.Values["token_expiry"].(int64); ok {
+		token.Expiry = time.Unix(expiry, 0)
+	}
+
+	return token, true
+}
+
+// An access token for an API, cached in the session by the resource indicator of the API.
+type ApiToken struct {
+	AccessToken string
+	TokenType   string
+	Expiry      int64
+}
+
+// Saves an access token for the API with the resource indicator in the token cache of the session.
+// A new refresh token in the response replaces the refresh token in the session.
+func SaveApiToken(session *sessions.Session, resource string, token *oauth2.Token) {
+	apiTokens, ok := session.Values["api_tokens"].(map[string]ApiToken)
+	if !ok {
+		apiTokens = map[string]ApiToken{}
+	}
+
+	apiTokens[resource] = ApiToken{
+		AccessToken: token.AccessToken,
+		TokenType:   token.TokenType,
+		Expiry:      token.Expiry.Unix(),
+	}
+	session.Values["api_tokens"] = apiTokens
+
+	if token.RefreshToken != "" {
+		session.Values["refresh_token"] = token.RefreshToken
+	}
+}
+
+// Gets the access token for the API with the resource indicator from the token cache of the session,
+// together with the refresh token of the session. Returns false if there is no token for the API.
+func GetApiToken(session *sessions.Session, resource string) (*oauth2.Token, bool) {
+	apiTokens, _ := session.Values["api_tokens"].(map[string]ApiToken)
+	apiToken, ok := apiTokens[resource]
+	if !ok {
+		return nil, false
+	}
+
+	token := &oauth2.Token{
+		AccessToken: apiToken.AccessToken,
+		TokenType:   apiToken.TokenType,
+		Expiry:      time.Unix(apiToken.Expiry, 0),
+	}
+	token.RefreshToken, _ = session.Values["refresh_token"].(string)
+
+	return token, true
+}
@@ -0,0 +1,90 @@
+package sessionstorage
+
+import (
+	"errors"
+	"helseid-webapp/organization"
+	"helseid-webapp/stepup"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// how long the user has to complete a login started at /login
+const loginTransactionTTL = 10 * time.Minute
+
+// how many logins can be pending in a session at the same time, the oldest is dropped when a new login is started
+const maxLoginTransactions = 5
+
+var ErrLoginTransactionNotFound = errors.New("no pending login for the state, it may have expired or already been used")
+
+// The values of a login started at /login, that are needed to complete the login at /callback.
+type LoginTransaction struct {
+	State        string
+	Nonce        string
+	CodeVerifier string
+	// the url the user is sent to after login
+	ReturnTo string
+	// how the user must authenticate, checked when the login is completed
+	Requirement stepup.Requirement
+	// the organization the user logs in on behalf of
+	Organization organization.Organization
+	// the identity provider HelseID sends the user to, if empty the user chooses the identity provider at HelseID
+	Idp string
+	// sent to HelseID as prompt, e.g. "select_account"
+	Prompt string
+	// sent to HelseID as login_hint
+	LoginHint string
+	Created   time.Time
+}
+
+// Saves a login transaction in the session, keyed by its state, so several logins can be pending at the same time
+// (e.g. in two browser tabs). Expired transactions are removed. The caller must save the session afterwards.
+func SaveLoginTransaction(session *sessions.Session, transaction LoginTransaction) {
+	transactions := getLoginTransactions(session)
+
+	// drop the oldest transactions to stay within the limit
+	for len(transactions) >= maxLoginTransactions {
+		oldest := ""
+		for state, t := range transactions {
+			if oldest == "" || t.Created.Before(transactions[oldest].Created) {
+				oldest = state
+			}
+		}
+		delete(transactions, oldest)
+	}
+
+	transactions[transaction.State] = transaction
+	session.Values["login_transactions"] = transactions
+}
+
+// Removes the login transaction with the state from the session and returns it, so it can only be used once.
+// Returns ErrLoginTransactionNotFound if there is no transaction with the state or it has expired.
+// The caller must save the session afterwards.
+func ConsumeLoginTransaction(session *sessions.Session, state string) (*LoginTransaction, error) {
+	transactions := getLoginTransactions(session)
+
+	transaction, ok := transactions[state]
+	if !ok || state == "" {
+		return nil, ErrLoginTransactionNotFound
+	}
+	delete(transactions, state)
+	session.Values["login_transactions"] = transactions
+
+	return &transaction, nil
+}
+
+// Gets the transactions in the session that have not expired.
+func getLoginTransactions(session *sessions.Session) map[string]LoginTransaction {
+	transactions, ok := session.Values["login_transactions"].(map[string]LoginTransaction)
+	if !ok {
+		return map[string]LoginTransaction{}
+	}
+
+	for state, transaction := range transactions {
+		if time.Since(transaction.Created) > loginTransactionTTL {
+			delete(transactions, state)
+		}
+	}
+
+	return transactions
+}
@@ -0,0 +1,75 @@
+package stepup
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// settings
+
+// The acr value to request from HelseID to get at least the security level.
+var securityLevelAcrValues = map[int]string{
+	3: "Level3",
+	4: "Level4",
+}
+
+// how much the clock of HelseID may differ from ours when checking auth_time
+const maxClockSkew = time.Minute
+
+// How the user must have authenticated to access a page. The zero value is met by any login.
+type Requirement struct {
+	// the minimum helseid://claims/identity/security_level
+	SecurityLevel int
+	// the acr claim must be one of these, if not empty
+	AcrValues []string
+	// the maximum time since the user authenticated (auth_time), if not zero
+	MaxAge time.Duration
+}
+
+// Checks that the claims of the id token meet the requirement.
+func (req Requirement) Check(claims map[string]interface{}) error {
+	if req.SecurityLevel > 0 {
+		securityLevel, _ := claims["helseid://claims/identity/security_level"].(string)
+		if level, _ := strconv.Atoi(securityLevel); level < req.SecurityLevel {
+			return fmt.Errorf("authenticated with security level %v, requires %v", securityLevel, req.SecurityLevel)
+		}
+	}
+
+	if len(req.AcrValues) > 0 {
+		acr, _ := claims["acr"].(string)
+		if !containsString(req.AcrValues, acr) {
+			return fmt.Errorf("authenticated with acr %v, requires one of %v", acr, req.AcrValues)
+		}
+	}
+
+	if req.MaxAge > 0 {
+		authTime, ok := claims["auth_time"].(float64)
+		if !ok {
+			return fmt.Errorf("the id token has no auth_time")
+		}
+		if time.Since(time.Unix(int64(authTime), 0)) > req.MaxAge+maxClockSkew {
+			return fmt.Errorf("authenticated at %v, requires authentication within the last %v", time.Unix(int64(authTime), 0), req.MaxAge)
+		}
+	}
+
+	return nil
+}
+
+// The acr_values to send in the login request to meet the requirement.
+func (req Requirement) RequestedAcrValues() []string {
+	acrValues := append([]string{}, req.AcrValues...)
+	if acrValue, ok := securityLevelAcrValues[req.SecurityLevel]; ok && !containsString(acrValues, acrValue) {
+		acrValues = append(acrValues, acrValue)
+	}
+	return acrValues
+}
+
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
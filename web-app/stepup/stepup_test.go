@@ -0,0 +1,105 @@
+package stepup
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	now := float64(time.Now().Unix())
+	level4 := map[string]interface{}{
+		"helseid://claims/identity/security_level": "4",
+		"acr":       "Level4",
+		"auth_time": now,
+	}
+
+	tests := []struct {
+		name        string
+		requirement Requirement
+		claims      map[string]interface{}
+		wantErr     bool
+	}{
+		{name: "no requirement", requirement: Requirement{}, claims: map[string]interface{}{}},
+		{name: "security level met", requirement: Requirement{SecurityLevel: 4}, claims: level4},
+		{name: "higher security level", requirement: Requirement{SecurityLevel: 3}, claims: level4},
+		{
+			name:        "security level not met",
+			requirement: Requirement{SecurityLevel: 4},
+			claims:      map[string]interface{}{"helseid://claims/identity/security_level": "3"},
+			wantErr:     true,
+		},
+		{name: "missing security level", requirement: Requirement{SecurityLevel: 3}, claims: map[string]interface{}{}, wantErr: true},
+		{
+			name:        "security level not a string",
+			requirement: Requirement{SecurityLevel: 3},
+			claims:      map[string]interface{}{"helseid://claims/identity/security_level": float64(4)},
+			wantErr:     true,
+		},
+		{name: "acr met", requirement: Requirement{AcrValues: []string{"Level3", "Level4"}}, claims: level4},
+		{name: "acr not met", requirement: Requirement{AcrValues: []string{"Level3"}}, claims: level4, wantErr: true},
+		{name: "missing acr", requirement: Requirement{AcrValues: []string{"Level4"}}, claims: map[string]interface{}{}, wantErr: true},
+		{name: "recent authentication", requirement: Requirement{MaxAge: 5 * time.Minute}, claims: level4},
+		{
+			name:        "authentication within the clock skew",
+			requirement: Requirement{MaxAge: 5 * time.Minute},
+			claims:      map[string]interface{}{"auth_time": now - (5*time.Minute + maxClockSkew/2).Seconds()},
+		},
+		{
+			name:        "old authentication",
+			requirement: Requirement{MaxAge: 5 * time.Minute},
+			claims:      map[string]interface{}{"auth_time": now - (5*time.Minute + 2*maxClockSkew).Seconds()},
+			wantErr:     true,
+		},
+		{name: "missing auth_time", requirement: Requirement{MaxAge: 5 * time.Minute}, claims: map[string]interface{}{}, wantErr: true},
+		{
+			name:        "all met",
+			requirement: Requirement{SecurityLevel: 4, AcrValues: []string{"Level4"}, MaxAge: time.Minute},
+			claims:      level4,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.requirement.Check(test.claims)
+			if test.wantErr && err == nil {
+				t.Error("got no error, want an error")
+			}
+			if !test.wantErr && err != nil {
+				t.Errorf("got error %v, want no error", err)
+			}
+		})
+	}
+}
+
+func TestRequestedAcrValues(t *testing.T) {
+	tests := []struct {
+		name        string
+		requirement Requirement
+		want        []string
+	}{
+		{name: "no requirement", requirement: Requirement{}, want: []string{}},
+		{name: "security level", requirement: Requirement{SecurityLevel: 4}, want: []string{"Level4"}},
+		{name: "security level without acr value", requirement: Requirement{SecurityLevel: 2}, want: []string{}},
+		{name: "acr values", requirement: Requirement{AcrValues: []string{"custom"}}, want: []string{"custom"}},
+		{
+			name:        "acr values and security level",
+			requirement: Requirement{SecurityLevel: 3, AcrValues: []string{"custom"}},
+			want:        []string{"custom", "Level3"},
+		},
+		{
+			name:        "security level already in acr values",
+			requirement: Requirement{SecurityLevel: 4, AcrValues: []string{"Level4"}},
+			want:        []string{"Level4"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := test.requirement.RequestedAcrValues()
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package templates
+
+import (
+	"bytes"
+	"crypto/rand"
+	"embed"
+	"encoding/base64"
+	"fmt"
+	"helseid-webapp/auth"
+	"helseid-webapp/i18n"
+	"helseid-webapp/returnto"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// The templates are embedded in the binary, so the app does not depend on the directory it is started from.
+// Every page in pages/ defines the blocks "title" and "content", which are rendered in the shared layout.
+// The templates in partials/ can be used by all pages.
+//
+//go:embed layout.html partials/*.html pages/*.html
+var files embed.FS
+
+var pages = map[string]*template.Template{}
+
+// Parses the layout, the partials and the pages. Call this at startup, so the app does not start with a broken template.
+func Init() error {
+	base, err := template.ParseFS(files, "layout.html", "partials/*.html")
+	if err != nil {
+		return err
+	}
+
+	pageFiles, err := fs.Glob(files, "pages/*.html")
+	if err != nil {
+		return err
+	}
+
+	for _, pageFile := range pageFiles {
+		page, err := base.Clone()
+		if err != nil {
+			return err
+		}
+
+		_, err = page.ParseFS(files, pageFile)
+		if err != nil {
+			return err
+		}
+
+		name := strings.TrimSuffix(path.Base(pageFile), ".html")
+		pages[name] = page
+	}
+
+	return nil
+}
+
+// A link in the language toggle of the layout.
+type languageLink struct {
+	Code    string
+	Name    string
+	Url     string
+	Current bool
+}
+
+// Renders the page with the name of a file in pages/ without .html, e.g. "user". The data is available in the
+// templates, together with cspNonce, the nonce of the Content-Security-Policy that inline scripts must have,
+// language, the language of the user, and text, the text of the pages in the language of the user.
+func Render(w http.ResponseWriter, r *http.Request, status int, name string, data map[string]interface{}) {
+	page, ok := pages[name]
+	if !ok {
+		http.Error(w, "unknown template "+name, http.StatusInternalServerError)
+		return
+	}
+
+	nonce, err := newNonce()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	language := i18n.Language(r)
+	data["cspNonce"] = nonce
+	data["language"] = language
+	data["text"] = i18n.Text(language)
+	data["languages"] = languageLinks(r, language)
+
+	// render to a buffer first, so a failing template results in an error instead of half a page
+	var body bytes.Buffer
+	err = page.ExecuteTemplate(&body, "layout", data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Security-Policy", contentSecurityPolicy(nonce))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(body.Bytes())
+}
+
+// The language toggle sends the user back to the current page after changing the language.
+func languageLinks(r *http.Request, current string) []languageLink {
+	links := []languageLink{}
+	for _, language := range i18n.Languages {
+		links = append(links, languageLink{
+			Code:    language,
+			Name:    i18n.T(language, "languageName"),
+			Url:     "/language?" + url.Values{"lang": {language}, returnto.QueryParameter: {r.URL.RequestURI()}}.Encode(),
+			Current: language == current,
+		})
+	}
+	return links
+}
+
+// Only scripts with the nonce can run, so a script injected into a page is blocked even if it is not escaped.
+// The check_session_iframe of HelseID is the only page that can be framed.
+func contentSecurityPolicy(nonce string) string {
+	frameSrc := "'none'"
+	if iframeUrl, err := url.Parse(auth.HelseidMetadata.Check_session_iframe); err == nil && iframeUrl.Host != "" {
+		frameSrc = iframeUrl.Scheme + "://" + iframeUrl.Host
+	}
+
+	return fmt.Sprintf("default-src 'self'; script-src 'nonce-%v'; frame-src %v; object-src 'none'; base-uri 'none'; frame-ancestors 'none'", nonce, frameSrc)
+}
+
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}